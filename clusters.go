@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"query-security-contexts/scanner"
+)
+
+// defaultClusterConcurrency is the number of clusters scanned in parallel with -kubeconfigs or -contexts.
+const defaultClusterConcurrency = 4
+
+// clusterTarget is a cluster to scan as part of a multi-cluster run.
+type clusterTarget struct {
+	name string            // Tagged on each finding. The context, or the kubeconfig file name without its extension
+	conn connectionOptions // How to connect to the cluster
+}
+
+// clusterStatus records the outcome of scanning a cluster in the scan metadata, so failures are visible in the report.
+type clusterStatus struct {
+	Name    string `json:"name"`
+	Context string `json:"context,omitempty"` // The kubeconfig context which was used
+	Server  string `json:"server,omitempty"`  // URL of the k8s API server
+	Error   string `json:"error,omitempty"`   // Why the cluster could not be scanned. Empty when it was
+}
+
+// splitList splits a comma separated flag value, trimming the whitespace around each item and dropping empty ones.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// clusterTargets returns a cluster to scan for each of the kubeconfig files, using their current context, or for each
+// of the contexts in the kubeconfig set by conn. Cluster names must be unique so their findings can be told apart.
+func clusterTargets(conn connectionOptions, kubeconfigs, contexts []string) ([]clusterTarget, error) {
+	var targets []clusterTarget
+	for _, path := range kubeconfigs {
+		target := clusterTarget{name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), conn: conn}
+		target.conn.kubeconfig, target.conn.kubeconfigSet = path, true
+		targets = append(targets, target)
+	}
+	for _, name := range contexts {
+		target := clusterTarget{name: name, conn: conn}
+		target.conn.context = name
+		targets = append(targets, target)
+	}
+
+	names := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if names[target.name] {
+			return nil, fmt.Errorf("cluster %q is listed more than once, the kubeconfig file names and contexts must be unique", target.name)
+		}
+		names[target.name] = true
+	}
+	return targets, nil
+}
+
+// scanClusters scans each of the clusters with a pool of opts.clusterConcurrency workers, tagging every finding with
+// the cluster's name, and returns the combined report in the order the clusters were listed. A cluster which cannot be
+// connected to or scanned is logged and skipped, so one unreachable cluster does not hide the findings of the rest.
+// The status of each cluster is returned for the scan metadata, along with an error when any of them were skipped.
+// Each cluster is connected to and scanned with its own timeout.
+func scanClusters(ctx context.Context, opts options) ([]scanner.NamespaceFindings, []clusterStatus, error) {
+	reports := make([][]scanner.NamespaceFindings, len(opts.clusters))
+	statuses := make([]clusterStatus, len(opts.clusters))
+
+	// The scans run in parallel, so their findings are serialised before being streamed
+	var streamMu sync.Mutex
+	onFinding := opts.scan.OnFinding
+	if onFinding != nil {
+		opts.scan.OnFinding = func(f scanner.Finding) {
+			streamMu.Lock()
+			defer streamMu.Unlock()
+			onFinding(f)
+		}
+	}
+	// The progress of each scan is counted separately, so it cannot be combined into a single total
+	opts.scan.OnProgress = nil
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.clusterConcurrency)
+	for i, target := range opts.clusters {
+		wg.Add(1)
+		go func(i int, target clusterTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			statuses[i] = clusterStatus{Name: target.name}
+			report, err := scanCluster(ctx, target, opts, &statuses[i])
+			if err != nil {
+				slog.Error("Error whilst scanning cluster, skipping", "cluster", target.name, "err", err)
+				statuses[i].Error = err.Error()
+				return
+			}
+			slog.Info("Scanned cluster", "cluster", target.name, "failingFindings", scanner.Failures(report))
+			reports[i] = report
+		}(i, target)
+	}
+	wg.Wait()
+
+	combined := []scanner.NamespaceFindings{}
+	failed := 0
+	for i, report := range reports {
+		combined = append(combined, report...)
+		if statuses[i].Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return combined, statuses, fmt.Errorf("%d of %d clusters could not be scanned", failed, len(opts.clusters))
+	}
+	return combined, statuses, nil
+}
+
+// scanCluster connects to the cluster and scans it, recording the context and server which were used in status.
+func scanCluster(ctx context.Context, target clusterTarget, opts options, status *clusterStatus) ([]scanner.NamespaceFindings, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	c, err := connect(ctx, target.conn, opts.gatewayAPI)
+	if err != nil {
+		return nil, err
+	}
+	status.Context, status.Server = c.context, c.server
+
+	scanOpts := opts.scan
+	scanOpts.Cluster, scanOpts.GatewayClientset = target.name, c.gatewayClientset
+	report, err := scanner.Scan(ctx, c.clientset, scanOpts)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("scan timed out after %s, consider increasing -timeout", opts.timeout)
+	}
+	return report, err
+}
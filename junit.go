@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"query-security-contexts/scanner"
+)
+
+// The subset of the JUnit XML format which is rendered by CI test reporters.
+// See https://github.com/testmoapp/junitxml
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSkipped marks a test case as accepted by an exception, so it is shown without failing the report.
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitTestCaseName returns the name of the test case for the finding: the check and where it was found.
+func junitTestCaseName(f scanner.Finding) string {
+	name := f.Check
+	if f.Pod != "" {
+		name += " " + f.Pod
+	}
+	if f.Container != "" {
+		name += "/" + f.Container
+	}
+	return name
+}
+
+// writeJUnit writes the findings as a JUnit XML report, with a test suite for each scanned service and a test case
+// for each check. Failures carry the finding's message, and failures accepted by an exception are skipped. Special
+// characters are escaped by the XML encoder. The suites are in the order each service is first seen, so findings of a
+// service which are not next to each other, such as resolved baseline findings, are still in a single suite.
+func writeJUnit(w io.Writer, report []scanner.NamespaceFindings) error {
+	suites := junitTestSuites{Name: "query-k8s-security-contexts"}
+	suiteIndexes := make(map[string]int) // Index in suites.Suites by suite name
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			suiteName := f.Namespace + "/" + f.Subject()
+			i, ok := suiteIndexes[suiteName]
+			if !ok {
+				i = len(suites.Suites)
+				suiteIndexes[suiteName] = i
+				suites.Suites = append(suites.Suites, junitTestSuite{Name: suiteName})
+			}
+			suite := &suites.Suites[i]
+
+			tc := junitTestCase{Name: junitTestCaseName(f), ClassName: suiteName}
+			switch {
+			case f.Failed():
+				tc.Failure = &junitFailure{Message: f.Message(), Type: f.Severity, Text: scanner.CheckDescription(f.Check)}
+				suite.Failures++
+				suites.Failures++
+			case !f.Passed:
+				tc.Skipped = &junitSkipped{Message: "Accepted by an exception: " + f.Message()}
+				suite.Skipped++
+				suites.Skipped++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+			suite.Tests++
+			suites.Tests++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error whilst writing JUnit XML: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("error whilst encoding findings as JUnit XML: %w", err)
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return fmt.Errorf("error whilst writing JUnit XML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"query-security-contexts/scanner"
+)
+
+func TestWriteJUnitEscaping(t *testing.T) {
+	const pod, container = `web<1>&"x"`, `app&"<2>"`
+	report := []scanner.NamespaceFindings{{Namespace: "payments", Findings: []scanner.Finding{
+		{Namespace: "payments", Service: "web", Pod: pod, Container: container, Check: scanner.CheckPrivileged, Severity: scanner.SeverityCritical},
+		{Namespace: "payments", Service: "web", Pod: pod, Container: container, Check: scanner.CheckRunAsNonRoot, Severity: scanner.SeverityMedium, Accepted: true},
+		{Namespace: "payments", Service: "web", Pod: pod, Container: container, Check: scanner.CheckHostNetwork, Severity: scanner.SeverityHigh, Passed: true},
+	}}}
+
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, report); err != nil {
+		t.Fatalf("writeJUnit() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("writeJUnit() output does not start with the XML header:\n%s", buf.String())
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v, output:\n%s", err, buf.String())
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Skipped != 1 || len(suites.Suites) != 1 {
+		t.Fatalf("writeJUnit() = %+v, want 1 suite of 3 tests with 1 failure and 1 skipped", suites)
+	}
+	cases := suites.Suites[0].TestCases
+	if want := scanner.CheckPrivileged + " " + pod + "/" + container; cases[0].Name != want {
+		t.Errorf("test case name = %q, want %q", cases[0].Name, want)
+	}
+	if cases[0].Failure == nil || !strings.Contains(cases[0].Failure.Message, container) {
+		t.Errorf("test case failure = %+v, want the message of the finding", cases[0].Failure)
+	}
+	if cases[1].Skipped == nil || cases[1].Failure != nil {
+		t.Errorf("accepted test case = %+v, want it skipped", cases[1])
+	}
+	if cases[2].Skipped != nil || cases[2].Failure != nil {
+		t.Errorf("passed test case = %+v, want neither failed nor skipped", cases[2])
+	}
+}
+
+func TestWriteJUnitGroupsSuites(t *testing.T) {
+	// Resolved baseline findings are appended after the namespace's sorted findings
+	report := []scanner.NamespaceFindings{{Namespace: "payments", Findings: []scanner.Finding{
+		{Namespace: "payments", Service: "api", Pod: "api-1", Check: scanner.CheckPrivileged, Severity: scanner.SeverityCritical},
+		{Namespace: "payments", Service: "web", Pod: "web-1", Check: scanner.CheckPrivileged, Severity: scanner.SeverityCritical},
+		{Namespace: "payments", Service: "api", Pod: "api-1", Check: scanner.CheckHostNetwork, Severity: scanner.SeverityHigh, Passed: true, Baseline: scanner.BaselineResolved},
+	}}}
+
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, report); err != nil {
+		t.Fatalf("writeJUnit() error = %v", err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+	if len(suites.Suites) != 2 {
+		t.Fatalf("writeJUnit() suites = %+v, want one for each service", suites.Suites)
+	}
+	if api := suites.Suites[0]; api.Name != "payments/api" || api.Tests != 2 || api.Failures != 1 {
+		t.Errorf("api suite = %s with %d tests and %d failures, want payments/api with 2 tests and 1 failure", api.Name, api.Tests, api.Failures)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	// Register the OIDC and cloud provider auth plugins referenced by auth-provider entries in kubeconfigs. Exec
+	// credential plugins are supported by client-go without registration
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// connectionOptions holds the command line flags which control how to connect to the k8s API server.
+type connectionOptions struct {
+	kubeconfig     string // Path to the kubeconfig file
+	kubeconfigSet  bool   // Whether the kubeconfig path was explicitly set, rather than being the default
+	kubeconfigData string // Raw or base64 encoded kubeconfig YAML, used instead of a file when set
+	inCluster      bool   // Use the in-cluster service account config
+	context        string // The kubeconfig context to use. Empty for the current context
+
+	as      string   // Username to impersonate. Empty to use the credentials as they are
+	asGroup []string // Groups to impersonate, along with the username
+
+	qps   float64 // Maximum requests per second to the API server. Negative to disable client side rate limiting
+	burst int     // Maximum burst of requests above qps
+}
+
+// authProviderError explains how to fix a kubeconfig which references an auth provider that is not registered.
+func authProviderError(err error) error {
+	if !strings.Contains(err.Error(), "no Auth Provider found") {
+		return err
+	}
+	return fmt.Errorf("%w: the kubeconfig uses an auth-provider which is not supported. Supported providers are oidc, "+
+		"azure and gcp, which have been superseded by exec credential plugins such as kubelogin or gke-gcloud-auth-plugin", err)
+}
+
+// inClusterContext is the context name reported when using the in-cluster service account config.
+const inClusterContext = "in-cluster"
+
+// buildConfig returns the config for connecting to the k8s API server.
+// Unless -kubeconfig is explicitly set, the files listed in the KUBECONFIG environment variable are merged in the
+// same way as kubectl. The in-cluster config is used when inCluster is set, or when no kubeconfig has been explicitly
+// set, KUBECONFIG is empty and there is no file at the default kubeconfig path (e.g. when running as a pod).
+// When kubeconfigData is set, the kubeconfig is read from it rather than from a file.
+// The name of the context which was used is also returned, or in-cluster when using the in-cluster config.
+func buildConfig(conn connectionOptions) (*rest.Config, string, error) {
+	if conn.kubeconfigData != "" && !conn.inCluster {
+		return buildConfigFromData(conn)
+	}
+
+	inCluster := conn.inCluster
+	if !inCluster && !conn.kubeconfigSet && conn.context == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" {
+		if conn.kubeconfig == "" {
+			inCluster = true
+		} else if _, err := os.Stat(conn.kubeconfig); errors.Is(err, os.ErrNotExist) {
+			inCluster = true
+		}
+	}
+
+	if inCluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("error whilst loading the in-cluster config: %w", err)
+		}
+		return impersonate(config, conn), inClusterContext, nil
+	}
+
+	// use the current context in kubeconfig, unless a context has been explicitly requested
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if conn.kubeconfigSet {
+		loadingRules.ExplicitPath = conn.kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: conn.context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("error whilst loading the kubeconfig: %w", err)
+	}
+	contextName := raw.CurrentContext
+	if conn.context != "" {
+		if _, ok := raw.Contexts[conn.context]; !ok {
+			return nil, "", fmt.Errorf("context %q does not exist in the kubeconfig", conn.context)
+		}
+		contextName = conn.context
+	}
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("error whilst building the kubeconfig: %w", err)
+	}
+	return impersonate(config, conn), contextName, nil
+}
+
+// buildConfigFromData returns the config for connecting to the k8s API server from the kubeconfig YAML in
+// kubeconfigData, which can optionally be base64 encoded. This avoids writing credentials to disk in CI runners.
+func buildConfigFromData(conn connectionOptions) (*rest.Config, string, error) {
+	data := []byte(conn.kubeconfigData)
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(conn.kubeconfigData)); err == nil {
+		data = decoded
+	}
+
+	raw, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("error whilst loading the kubeconfig data: %w", err)
+	}
+	contextName := raw.CurrentContext
+	if conn.context != "" {
+		if _, ok := raw.Contexts[conn.context]; !ok {
+			return nil, "", fmt.Errorf("context %q does not exist in the kubeconfig data", conn.context)
+		}
+		contextName = conn.context
+	}
+
+	config, err := clientcmd.NewNonInteractiveClientConfig(*raw, conn.context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("error whilst building the kubeconfig from data: %w", err)
+	}
+	return impersonate(config, conn), contextName, nil
+}
+
+// rateLimit sets the client side rate limit on the config, so the scan can be made gentler on shared clusters or
+// faster on dedicated ones.
+func rateLimit(config *rest.Config, conn connectionOptions) *rest.Config {
+	config.QPS = float32(conn.qps)
+	config.Burst = conn.burst
+	return config
+}
+
+// impersonate sets the user and groups to impersonate on the config, mirroring kubectl's --as and --as-group flags,
+// so the scan only sees what that identity can access.
+func impersonate(config *rest.Config, conn connectionOptions) *rest.Config {
+	if conn.as != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: conn.as, Groups: conn.asGroup}
+	}
+	return config
+}
+
+// checkImpersonation makes a cheap request to the API server to confirm the credentials are permitted to impersonate
+// the requested identity, as otherwise every request fails with a less obvious 403. The request is bound by ctx, so an
+// unresponsive API server cannot block the scan indefinitely.
+func checkImpersonation(ctx context.Context, clientset kubernetes.Interface, conn connectionOptions) error {
+	if conn.as == "" {
+		return nil
+	}
+	err := clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+	if k8sErrors.IsForbidden(err) {
+		return fmt.Errorf("the current credentials are not permitted to impersonate %q: %w", conn.as, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error whilst checking impersonation: %w", err)
+	}
+	slog.Info("Impersonating", "user", conn.as, "groups", conn.asGroup)
+	return nil
+}
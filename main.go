@@ -2,105 +2,178 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
 
-	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/homedir"
+	gatewayclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+
+	"query-security-contexts/scanner"
 )
 
-// result stores information about a single service which provides an ingress (ingress or load balancer) into the k8s environment.
-type result struct {
-	name             string            // Ingress name for ingress based routes, service name for load balancer based routes
-	namespace        string            // Which namespace does the service belong in
-	backendService   string            // The backend k8s service which we are routing to
-	serviceSelectors map[string]string // The pod selectors used for the backend service
-}
+// options holds the command line flags which control a scan.
+type options struct {
+	output           string             // Output format for the findings
+	outputFile       string             // Write the findings to this file instead of stdout
+	outputTemplate   string             // Go text/template (or the path of one) to write the findings with
+	template         *template.Template // Parsed from outputTemplate
+	outputDir        string             // Directory the report files are written to with splitByNamespace
+	splitEmpty       bool               // Also write a report file for namespaces without any findings
+	splitByNamespace bool               // Write a report file per namespace to outputDir instead of a single report
+	exitZero         bool               // Do not return an error when failing checks are found
+	failOn           string             // Comma separated list of the checks whose failures return an error. Empty for all checks
+	gating           scanner.CheckSet   // Parsed from failOn. Nil for all checks
+	timeout          time.Duration      // Maximum duration of the scan before it is aborted
+	gatewayAPI       bool               // Also discover backend services from Gateway API HTTPRoute resources
+	summary          bool               // Print counts of failing checks instead of the individual findings
+	quiet            bool               // Only print the total number of failing checks
+	summaryLine      bool               // Print a machine-readable summary line to stderr once the scan completes
+	color            bool               // Highlight failures in the text and table output. Only applied when writing to a terminal
+	progress         bool               // Report how many services have been checked on stderr
+	showPassed       bool               // Also list the checks which passed in the text output
 
-// alreadyInResultsSlice checks if the namespaced service has already been stored in the results map.
-// This helps to dedup the services, so we are only checking each once.
-func alreadyInResultsSlice(serviceName, namespace string, results map[string][]result) bool {
-	for _, i := range results[namespace] {
-		if i.backendService == serviceName {
-			return true
-		}
-	}
-	return false
+	checks                   string // Comma separated list of the checks to run. Empty for all checks
+	checkServiceAccountToken bool   // Report pods which automatically mount their service account token
+
+	exceptionsFile     string // Path to a YAML file of accepted findings
+	policyFile         string // Path to a YAML file of custom rules
+	configFile         string // Path to a YAML file configuring what counts as passing for the checks
+	approvedImagesFile string // Path to a file of approved image name prefixes
+	baselineFile       string // Path to a previous JSON or YAML report to compare the findings with
+
+	pushgateway  string // URL of a Prometheus Pushgateway to push metrics to once the scan completes
+	slackWebhook string // URL of a Slack Incoming Webhook to post a summary of the failures to
+	slackAlways  bool   // Post to Slack even when there are no failures
+
+	watch         bool          // Keep running, re-scanning as resources change
+	watchDebounce time.Duration // How long changes are batched for before re-scanning
+
+	serve         string        // Address to serve the findings over HTTP on instead of scanning once
+	serveInterval time.Duration // Re-scan on this interval when serving. 0 to scan on each request
+
+	kubeconfigs        []string        // Kubeconfig files to scan the current context of, as one combined report
+	contexts           []string        // Kubeconfig contexts to scan, as one combined report
+	clusters           []clusterTarget // Built from kubeconfigs or contexts. Empty when scanning a single cluster
+	clusterConcurrency int             // Number of clusters scanned in parallel
+
+	manifest        string           // Path to a manifest file or directory to check instead of a live cluster
+	manifestObjects []runtime.Object // The objects decoded from the manifest
+
+	metadata scanMetadata // Describes the scan in the structured output. The timestamp is set when the scan starts
+
+	scan scanner.Options // Options passed through to the scanner
 }
 
-// processService queries for the k8s service and returns a result struct for further processing.
-// The 2nd return value is whether this resource should be skipped.
-func processService(clientset *kubernetes.Clientset, namespace, ingressName, backendServiceName string) (result, bool, error) {
-	var r result
-	service, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), backendServiceName, metav1.GetOptions{})
+// errFailingChecks is returned when failing checks are found, so the exit code reflects them.
+var errFailingChecks = errors.New("failing checks found")
 
-	if k8sErrors.IsNotFound(err) {
-		return r, true, nil
+// run discovers the services which have an ingress route, checks their security contexts and writes the findings
+// to w. An error is returned if any checks fail, unless exitZero is set. clientset is nil when checking a manifest.
+func run(ctx context.Context, w io.Writer, clientset kubernetes.Interface, opts options) error {
+	// NDJSON findings are streamed as each service is checked, rather than written once the scan completes
+	streamErr := func() error { return nil }
+	if opts.output == outputNDJSON && !opts.splitByNamespace {
+		opts.scan.OnFinding, streamErr = streamNDJSON(w)
 	}
-	// Does not contain any pods
-	if service.Spec.Type == "ExternalName" {
-		return r, true, nil
+
+	finishProgress := func() {}
+	if opts.progress {
+		opts.scan.OnProgress, finishProgress = newProgress(os.Stderr)
 	}
-	// Handled separately from the ingress rules
-	if service.Spec.Type == "LoadBalancer" {
-		return r, true, nil
+
+	// Set by the scan of each cluster, which may run in parallel
+	var truncated atomic.Bool
+	opts.scan.OnTruncated = func() { truncated.Store(true) }
+
+	opts.metadata.Timestamp = time.Now().UTC()
+	var report []scanner.NamespaceFindings
+	var err, clusterErr error
+	if len(opts.clusters) > 0 {
+		// Clusters which cannot be scanned are reported once the combined report has been written
+		report, opts.metadata.Clusters, clusterErr = scanClusters(ctx, opts)
+	} else {
+		report, err = scanReport(ctx, clientset, opts)
 	}
+	duration := time.Since(opts.metadata.Timestamp)
+	finishProgress()
 	if err != nil {
-		return r, false, fmt.Errorf("error whilst listing service: %w", err)
+		return err
 	}
-
-	r = result{
-		name:             ingressName,
-		namespace:        namespace,
-		backendService:   backendServiceName,
-		serviceSelectors: service.Spec.Selector,
+	if err := streamErr(); err != nil {
+		return err
 	}
 
-	return r, false, nil
-}
-
-// checkSecurityContexts checks whether the services listed in the results map have certain k8s security contexts enabled.
-// Currently just outputs to the console.
-func checkSecurityContexts(clientset *kubernetes.Clientset, results map[string][]result) error {
-	for namespace, slice := range results {
-		for _, i := range slice {
-			labelSelector := metav1.LabelSelector{MatchLabels: i.serviceSelectors}
-			listOptions := metav1.ListOptions{
-				LabelSelector: labels.Set(labelSelector.MatchLabels).String(),
-			}
-			pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), listOptions)
-			if err != nil {
-				return fmt.Errorf("error whilst listing pods: %w", err)
-			}
+	if truncated.Load() {
+		slog.Warn("Output truncated, increase -max-findings to see them all", "failingFindings", fmt.Sprintf("%d+", opts.scan.MaxFindings))
+	}
 
-			if len(pods.Items) <= 0 {
-				fmt.Printf("No active pods found for ingress %s (service %s, namespace: %s), skipping\n", i.name, i.backendService, i.namespace)
-				continue
-			}
+	switch {
+	case opts.quiet:
+		if _, err = fmt.Fprintln(w, scanner.Failures(report)); err != nil {
+			err = fmt.Errorf("error whilst writing failing checks count: %w", err)
+		}
+	case opts.summary:
+		err = writeSummary(w, report)
+	case opts.template != nil:
+		err = writeTemplate(w, opts.template, opts.metadata, report)
+	case opts.splitByNamespace:
+		err = writeSplitReport(opts.outputDir, opts.output, opts.showPassed, opts.metadata, report, opts.splitEmpty)
+	default:
+		err = writeReport(w, opts.output, opts.color, opts.showPassed, opts.metadata, report)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.summaryLine {
+		if err := writeSummaryLine(os.Stderr, report, duration); err != nil {
+			return err
+		}
+	}
 
-			// Check just the first pod
-			pod := pods.Items[0]
-			if pod.Spec.SecurityContext == nil || pod.Spec.SecurityContext.RunAsNonRoot == nil || *pod.Spec.SecurityContext.RunAsNonRoot != true {
-				fmt.Printf("%s: RunAsNonRoot is not set to true (pod: %s)\n", i.backendService, pod.Name)
-			}
-			for _, container := range pod.Spec.Containers {
-				if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil || *container.SecurityContext.AllowPrivilegeEscalation != false {
-					fmt.Printf("%s: AllowPrivilegeEscalation is not set to false for service (pod: %s, container: %s)\n", i.backendService, pod.Name, container.Name)
-				}
-				if container.SecurityContext == nil || container.SecurityContext.ReadOnlyRootFilesystem == nil || *container.SecurityContext.ReadOnlyRootFilesystem != true {
-					fmt.Printf("%s: ReadOnlyRootFilesystem is not enabled for service (pod: %s, container: %s)\n", i.backendService, pod.Name, container.Name)
-				}
-			}
-			fmt.Println()
+	if opts.pushgateway != "" {
+		if err := pushMetrics(ctx, opts.pushgateway, report); err != nil {
+			return err
+		}
+		slog.Info("Pushed metrics", "pushgateway", opts.pushgateway)
+	}
+	if opts.slackWebhook != "" {
+		if err := notifySlack(ctx, opts.slackWebhook, opts.slackAlways, report); err != nil {
+			return err
 		}
 	}
 
-	return nil
+	failures := scanner.GatingFailures(report, opts.gating)
+	if failures > 0 && !opts.exitZero {
+		return errors.Join(fmt.Errorf("%d %w", failures, errFailingChecks), clusterErr)
+	}
+	if nonGating := scanner.Failures(report) - failures; nonGating > 0 {
+		slog.Info("Failing checks not included in -fail-on were reported without failing the scan", "count", nonGating)
+	}
+
+	return clusterErr
+}
+
+// scanReport scans the manifest when one is set, otherwise the cluster.
+func scanReport(ctx context.Context, clientset kubernetes.Interface, opts options) ([]scanner.NamespaceFindings, error) {
+	if opts.manifest != "" {
+		return scanner.ScanManifests(ctx, opts.manifestObjects, opts.scan)
+	}
+	return scanner.Scan(ctx, clientset, opts.scan)
 }
 
 func main() {
@@ -110,92 +183,413 @@ func main() {
 	} else {
 		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+	var conn connectionOptions
+	flag.StringVar(&conn.kubeconfigData, "kubeconfig-data", "", "(optional) raw or base64 encoded kubeconfig YAML to use instead of a file. Defaults to the KUBECONFIG_DATA environment variable")
+	flag.BoolVar(&conn.inCluster, "in-cluster", false, "use the in-cluster service account config rather than a kubeconfig file")
+	flag.StringVar(&conn.context, "context", "", "(optional) the kubeconfig context to use. Defaults to the current context")
+	flag.StringVar(&conn.as, "as", "", "(optional) username to impersonate for the scan, e.g. system:serviceaccount:payments:default")
+	flag.Func("as-group", "(optional) group to impersonate for the scan. Can be repeated", func(group string) error {
+		conn.asGroup = append(conn.asGroup, group)
+		return nil
+	})
+	var opts options
+	flag.Float64Var(&conn.qps, "qps", float64(rest.DefaultQPS), "maximum requests per second to the API server. -1 disables client side rate limiting")
+	flag.IntVar(&conn.burst, "burst", rest.DefaultBurst, "maximum burst of requests to the API server above -qps")
+	flag.Func("kubeconfigs", "(optional) comma separated list of kubeconfig files to scan the current context of, combining the findings into one report tagged by cluster", func(value string) error {
+		opts.kubeconfigs = append(opts.kubeconfigs, splitList(value)...)
+		return nil
+	})
+	flag.Func("contexts", "(optional) comma separated list of kubeconfig contexts to scan, combining the findings into one report tagged by cluster", func(value string) error {
+		opts.contexts = append(opts.contexts, splitList(value)...)
+		return nil
+	})
+	flag.IntVar(&opts.clusterConcurrency, "cluster-concurrency", defaultClusterConcurrency, "number of clusters scanned in parallel with -kubeconfigs or -contexts")
+	flag.StringVar(&opts.output, "output", outputText, "output format for the findings: text, table, json, ndjson, yaml, csv, sarif or junit")
+	flag.BoolVar(&opts.progress, "progress", false, "report how many services have been checked on stderr during the scan. Defaults to true when stderr is a terminal")
+	flag.BoolVar(&opts.color, "color", false, "highlight failures by severity in the text output, and in red in the table output, when writing to a terminal. Defaults to true unless NO_COLOR is set")
+	flag.StringVar(&opts.outputTemplate, "output-template", "", "(optional) Go text/template, or the path of a file containing one, to write the findings with instead of -output. See the README for the fields available")
+	flag.StringVar(&opts.outputFile, "output-file", "", "write the findings to this file instead of stdout. Parent directories are created and an existing file is truncated")
+	flag.BoolVar(&opts.splitByNamespace, "split-by-namespace", false, "write a report file per namespace, named after the namespace, to -output-dir instead of a single report")
+	flag.StringVar(&opts.outputDir, "output-dir", "", "directory to write the report files to with -split-by-namespace. Created if it does not exist")
+	flag.BoolVar(&opts.splitEmpty, "split-include-empty", false, "also write a report file for namespaces without any findings with -split-by-namespace")
+	flag.StringVar(&opts.manifest, "manifest", "", "(optional) path to a YAML manifest file, or directory of manifests, to check instead of a live cluster")
+	flag.StringVar(&opts.scan.Namespace, "namespace", "", "(optional) only scan this namespace. Defaults to all namespaces")
+	flag.Func("namespaces", "(optional) comma separated list of the namespaces to scan, e.g. payments,checkout. Namespaces which do not exist are skipped with a warning", func(value string) error {
+		for _, namespace := range strings.Split(value, ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" && !slices.Contains(opts.scan.Namespaces, namespace) {
+				opts.scan.Namespaces = append(opts.scan.Namespaces, namespace)
+			}
+		}
+		return nil
+	})
+	flag.StringVar(&opts.scan.Service, "service", "", "(optional) only check this service in -namespace, skipping the discovery of ingress routes")
+	flag.BoolVar(&opts.exitZero, "exit-zero", false, "exit with a zero status code even when failing checks are found")
+	flag.StringVar(&opts.failOn, "fail-on", "", "(optional) comma separated list of the checks whose failures cause a non-zero exit code, e.g. privileged,hostnetwork. Defaults to all checks")
+	flag.BoolVar(&opts.gatewayAPI, "gateway-api", false, "also check services which are routed to by Gateway API HTTPRoute resources")
+	flag.BoolVar(&opts.scan.AllWorkloads, "all-workloads", false, "also check the pod templates of all Deployments, StatefulSets, DaemonSets, CronJobs and Jobs")
+	flag.StringVar(&opts.scan.IngressSelector, "ingress-selector", "", "(optional) label selector restricting which ingresses are scanned, e.g. audit=true")
+	flag.StringVar(&opts.scan.IngressClass, "ingress-class", "", "(optional) only scan ingresses with this spec.ingressClassName, e.g. nginx-public. Defaults to all classes")
+	flag.StringVar(&opts.scan.ServiceSelector, "service-selector", "", "(optional) label selector restricting which LoadBalancer (and ClusterIP, with -include-clusterip) services are scanned")
+	flag.BoolVar(&opts.scan.WarnMissingBackends, "warn-missing-backends", false, "report ingress backends which reference a service that does not exist, rather than skipping them")
+	flag.BoolVar(&opts.scan.UseEndpoints, "use-endpoints", false, "check the pods targeted by each service's EndpointSlices rather than those matching its selector, falling back to the selector when there are none")
+	flag.DurationVar(&opts.scan.MinPodAge, "min-pod-age", 0, "skip pods created more recently than this, e.g. 5m, as they may transiently fail checks during a rollout. 0 to check every pod")
+	flag.StringVar(&opts.scan.OwnerLabel, "owner-label", "", "namespace label whose value is added to each finding as the namespace owner, e.g. team")
+	flag.BoolVar(&opts.scan.IncludeClusterIP, "include-clusterip", false, "also check all ClusterIP services, e.g. those exposed via a service mesh")
+	flag.StringVar(&opts.pushgateway, "pushgateway", "", "(optional) URL of a Prometheus Pushgateway to push metrics about the failing checks to")
+	flag.StringVar(&opts.slackWebhook, "slack-webhook", "", "(optional) URL of a Slack Incoming Webhook to post a summary of the failing checks to")
+	flag.BoolVar(&opts.slackAlways, "slack-always", false, "post to Slack even when there are no failing checks")
+	flag.Int64Var(&opts.scan.PageSize, "page-size", scanner.DefaultPageSize, "number of items requested per List call. 0 disables pagination")
+	flag.BoolVar(&opts.quiet, "quiet", false, "only print the total number of failing checks, and only log errors to stderr")
+	flag.BoolVar(&opts.showPassed, "show-passed", false, "also list the checks which passed for each pod and container in the text output, e.g. to show what was verified in an audit")
+	flag.BoolVar(&opts.summary, "summary", false, "print counts of failing checks per check and namespace instead of the individual findings")
+	flag.BoolVar(&opts.summaryLine, "summary-line", false, "print a final SCAN_RESULT line of key=value counts to stderr once the scan completes, for scripts to grep")
+	flag.StringVar(&opts.checks, "checks", "", "(optional) comma separated list of the checks to run, e.g. privileged,runasnonroot. Defaults to all checks")
+	flag.BoolVar(&opts.checkServiceAccountToken, "check-service-account-token", true, "report pods which automatically mount their service account token. Set to false for workloads which need API access")
+	flag.StringVar(&opts.baselineFile, "baseline", "", "(optional) path to a previous JSON or YAML report, used to mark each failure as new, existing or resolved")
+	flag.StringVar(&opts.approvedImagesFile, "approved-images", "", "(optional) path to a file of approved image name prefixes, one per line, used to annotate whether each finding's image is approved")
+	flag.StringVar(&opts.configFile, "config", "", "(optional) path to a YAML file configuring what counts as passing for some checks, e.g. runAsNonRoot.minRunAsUser. Defaults to strict")
+	flag.StringVar(&opts.policyFile, "policy", "", "(optional) path to a YAML file of custom rules to check in addition to the built-in checks")
+	flag.StringVar(&opts.exceptionsFile, "exceptions", "", "path to a YAML file of namespace/service/check exceptions to accept")
+	flag.StringVar(&opts.scan.MinSeverity, "min-severity", scanner.SeverityLow, "only report findings at or above this severity: critical, high, medium or low")
+	flag.BoolVar(&opts.scan.SkipForbidden, "skip-forbidden", true, "skip namespaces where access is forbidden by RBAC rather than aborting the scan. Set to false to fail fast")
+	flag.IntVar(&opts.scan.MaxFindings, "max-findings", 0, "stop the scan once this many failing findings have been found, to bound the output. 0 for no limit")
+	flag.IntVar(&opts.scan.Concurrency, "concurrency", scanner.DefaultConcurrency, "number of services to check in parallel")
+	flag.BoolVar(&opts.watch, "watch", false, "keep running, watching ingresses, services and pods and printing new failures as they change")
+	flag.DurationVar(&opts.watchDebounce, "watch-debounce", scanner.DefaultWatchDebounce, "how long changes are batched for before re-scanning in -watch mode")
+	flag.StringVar(&opts.serve, "serve", "", "(optional) address to serve the findings as JSON on at /findings, e.g. :8080, rather than scanning once")
+	flag.DurationVar(&opts.serveInterval, "serve-interval", 0, "re-scan on this interval in -serve mode and serve the latest findings. 0 to scan on each request")
+	flag.DurationVar(&opts.timeout, "timeout", 30*time.Second, "maximum duration of the scan before it is aborted")
+	printVersion := flag.Bool("version", false, "print the version, git commit and build date, then exit")
+	logLevel := flag.String("log-level", "info", "level of the diagnostic messages written to stderr: debug, info, warn or error")
 	flag.Parse()
 
-	// use the current context in kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
-	if err != nil {
-		panic(err.Error())
+	if *printVersion {
+		buildCommit, buildDate := buildInfo()
+		fmt.Printf("query-k8s-security-contexts %s (commit %s, built %s)\n", toolVersion(), buildCommit, buildDate)
+		return
 	}
 
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err.Error())
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "error: unsupported log level %q, must be one of: debug, info, warn, error\n", *logLevel)
+		os.Exit(1)
 	}
+	if opts.quiet {
+		level = slog.LevelError
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
-	ingresses, err := clientset.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		panic(err.Error())
+	// Read from the environment rather than as the flag default, so the credentials are not printed by -help. Each
+	// cluster has its own kubeconfig when scanning several
+	if conn.kubeconfigData == "" && len(opts.kubeconfigs) == 0 && len(opts.contexts) == 0 {
+		conn.kubeconfigData = os.Getenv("KUBECONFIG_DATA")
 	}
-	fmt.Printf("Found %d ingress resources\n", len(ingresses.Items))
 
-	// stores the deduplicated services as a slice, keyed by namespace
-	results := make(map[string][]result)
+	// Only fall back to the in-cluster config if the kubeconfig has not been explicitly set
+	conn.kubeconfig = *kubeconfig
+	progressSet, colorSet := false, false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "kubeconfig":
+			conn.kubeconfigSet = true
+		case "progress":
+			progressSet = true
+		case "color":
+			colorSet = true
+		}
+	})
+	if !progressSet {
+		opts.progress = isTerminal(os.Stderr) && !opts.quiet
+	}
+	if !colorSet {
+		// See https://no-color.org
+		opts.color = os.Getenv("NO_COLOR") == ""
+	}
 
-	// Check for services which have at least 1 ingress route
-	for _, i := range ingresses.Items {
+	opts.metadata = scanMetadata{Manifest: opts.manifest, Version: toolVersion(), Flags: flagsUsed()}
 
-		// Using a default backend
-		if i.Spec.DefaultBackend != nil {
-			fmt.Printf("Default backend defined: %#v\n", i.Spec.DefaultBackend)
+	if err := runCLI(conn, opts); err != nil {
+		// The count has already been printed, which is all quiet mode should output
+		if opts.quiet && errors.Is(err, errFailingChecks) {
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-			if !alreadyInResultsSlice(i.Spec.DefaultBackend.Service.Name, i.Namespace, results) {
-				r, skip, err := processService(clientset, i.Namespace, i.Name, i.Spec.DefaultBackend.Service.Name)
-				if skip {
-					continue
-				}
-				if err != nil {
-					panic(err.Error())
-				}
-				results[i.Namespace] = append(results[i.Namespace], r)
-			}
+// runCLI builds the k8s client and runs the scan.
+func runCLI(conn connectionOptions, opts options) error {
+	switch opts.output {
+	case outputText, outputTable, outputJSON, outputNDJSON, outputYAML, outputCSV, outputSARIF, outputJUnit:
+	default:
+		return fmt.Errorf("unsupported output format %q, must be one of: text, table, json, ndjson, yaml, csv, sarif, junit", opts.output)
+	}
+	if opts.summary && opts.output != outputText {
+		return fmt.Errorf("-summary can only be used with -output=text")
+	}
+	if opts.watch {
+		if opts.output != outputText && opts.output != outputNDJSON {
+			return fmt.Errorf("-watch can only be used with -output=text or -output=ndjson")
+		}
+		if opts.summary || opts.manifest != "" || opts.pushgateway != "" || opts.slackWebhook != "" {
+			return fmt.Errorf("-watch cannot be used with -summary, -manifest, -pushgateway or -slack-webhook")
+		}
+	}
+	if opts.serve != "" {
+		if opts.output != outputText && opts.output != outputJSON {
+			return fmt.Errorf("-serve always serves JSON, so can only be used with -output=json")
+		}
+		if opts.watch || opts.summary || opts.outputFile != "" || opts.pushgateway != "" || opts.slackWebhook != "" {
+			return fmt.Errorf("-serve cannot be used with -watch, -summary, -output-file, -pushgateway or -slack-webhook")
+		}
+	}
+	if opts.outputTemplate != "" {
+		if opts.output != outputText || opts.summary || opts.quiet || opts.watch || opts.serve != "" || opts.splitByNamespace {
+			return fmt.Errorf("-output-template cannot be used with -output, -summary, -quiet, -watch, -serve or -split-by-namespace")
+		}
+		tmpl, err := parseOutputTemplate(opts.outputTemplate)
+		if err != nil {
+			return err
+		}
+		opts.template = tmpl
+	}
+	if opts.quiet && (opts.output != outputText || opts.summary || opts.watch || opts.serve != "" || opts.splitByNamespace) {
+		return fmt.Errorf("-quiet cannot be used with -output, -summary, -watch, -serve or -split-by-namespace")
+	}
+	if opts.showPassed && (opts.output != outputText || opts.summary || opts.quiet || opts.outputTemplate != "" || opts.watch || opts.serve != "") {
+		return fmt.Errorf("-show-passed can only be used with -output=text, and cannot be used with -summary, -quiet, -output-template, -watch or -serve")
+	}
+	if opts.summaryLine && (opts.watch || opts.serve != "") {
+		return fmt.Errorf("-summary-line cannot be used with -watch or -serve")
+	}
+	if opts.splitByNamespace != (opts.outputDir != "") {
+		return fmt.Errorf("-split-by-namespace and -output-dir must be used together")
+	}
+	if opts.splitByNamespace && (opts.outputFile != "" || opts.summary || opts.watch || opts.serve != "") {
+		return fmt.Errorf("-split-by-namespace cannot be used with -output-file, -summary, -watch or -serve")
+	}
+	if len(opts.scan.Namespaces) > 0 && (opts.scan.Namespace != "" || opts.scan.Service != "") {
+		return fmt.Errorf("-namespaces cannot be used with -namespace or -service")
+	}
+	if opts.scan.Service != "" {
+		if opts.scan.Namespace == "" {
+			return fmt.Errorf("-service must be used with -namespace")
+		}
+		if opts.manifest != "" || opts.gatewayAPI || opts.scan.AllWorkloads || opts.scan.IncludeClusterIP || opts.scan.IngressSelector != "" || opts.scan.IngressClass != "" || opts.scan.ServiceSelector != "" {
+			return fmt.Errorf("-service skips discovery, so cannot be used with -manifest, -gateway-api, -all-workloads, -include-clusterip, -ingress-selector, -ingress-class or -service-selector")
 		}
+	}
+	if opts.scan.MinPodAge < 0 {
+		return fmt.Errorf("-min-pod-age must not be negative, got %s", opts.scan.MinPodAge)
+	}
+	if opts.serveInterval < 0 {
+		return fmt.Errorf("-serve-interval must not be negative, got %s", opts.serveInterval)
+	}
+	if !scanner.ValidSeverity(opts.scan.MinSeverity) {
+		return fmt.Errorf("unsupported severity %q, must be one of: critical, high, medium, low", opts.scan.MinSeverity)
+	}
+	if opts.policyFile != "" {
+		policy, err := scanner.LoadPolicy(opts.policyFile)
+		if err != nil {
+			return err
+		}
+		opts.scan.Policy = policy
+	}
+	// The custom policy rules always run, so only the built-in checks can be chosen with -checks
+	checks, err := scanner.ParseChecks(opts.checks, nil)
+	if err != nil {
+		return err
+	}
+	if !opts.checkServiceAccountToken {
+		delete(checks, scanner.CheckServiceAccountToken)
+	}
+	opts.scan.Checks = checks
+	if opts.failOn != "" {
+		if opts.gating, err = scanner.ParseChecks(opts.failOn, opts.scan.Policy); err != nil {
+			return fmt.Errorf("error whilst parsing -fail-on: %w", err)
+		}
+	}
+	if opts.scan.PageSize < 0 {
+		return fmt.Errorf("-page-size must not be negative, got %d", opts.scan.PageSize)
+	}
+	if opts.scan.MaxFindings < 0 {
+		return fmt.Errorf("-max-findings must not be negative, got %d", opts.scan.MaxFindings)
+	}
+	if opts.scan.Concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1, got %d", opts.scan.Concurrency)
+	}
 
-		// Using HTTP host paths
-		for _, h := range i.Spec.Rules {
-			for _, p := range h.HTTP.Paths {
-
-				if !alreadyInResultsSlice(p.Backend.Service.Name, i.Namespace, results) {
-					r, skip, err := processService(clientset, i.Namespace, i.Name, p.Backend.Service.Name)
-					if skip {
-						continue
-					}
-					if err != nil {
-						panic(err.Error())
-					}
-					results[i.Namespace] = append(results[i.Namespace], r)
-				}
-			}
+	if opts.exceptionsFile != "" {
+		exceptions, err := scanner.LoadExceptions(opts.exceptionsFile, opts.scan.Policy)
+		if err != nil {
+			return err
+		}
+		opts.scan.Exceptions = exceptions
+	}
+	if opts.configFile != "" {
+		compliance, err := scanner.LoadConfig(opts.configFile)
+		if err != nil {
+			return err
+		}
+		opts.scan.Compliance = compliance
+	}
+	if opts.approvedImagesFile != "" {
+		approvedImages, err := scanner.LoadApprovedImages(opts.approvedImagesFile)
+		if err != nil {
+			return err
+		}
+		opts.scan.ApprovedImages = approvedImages
+	}
+	if opts.baselineFile != "" {
+		baseline, err := scanner.LoadBaseline(opts.baselineFile)
+		if err != nil {
+			return err
 		}
+		opts.scan.Baseline = baseline
 	}
 
-	// Check for services which have a LoadBalancer ingress
-	loadBalancerServices, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		panic(err.Error())
-	}
-	for _, svc := range loadBalancerServices.Items {
-		if svc.Spec.Type == "LoadBalancer" {
-			r := result{
-				name:             svc.Name,
-				namespace:        svc.Namespace,
-				backendService:   svc.Name,
-				serviceSelectors: svc.Spec.Selector,
+	if len(conn.asGroup) > 0 && conn.as == "" {
+		return fmt.Errorf("-as-group can only be used with -as")
+	}
+	if conn.qps == 0 {
+		return fmt.Errorf("-qps must not be 0, pass -1 to disable client side rate limiting")
+	}
+	if conn.burst < 1 {
+		return fmt.Errorf("-burst must be at least 1, got %d", conn.burst)
+	}
+
+	if len(opts.kubeconfigs) > 0 || len(opts.contexts) > 0 {
+		if len(opts.kubeconfigs) > 0 && len(opts.contexts) > 0 {
+			return fmt.Errorf("-kubeconfigs and -contexts cannot be used together")
+		}
+		if opts.manifest != "" || opts.watch || opts.serve != "" || opts.splitByNamespace || conn.context != "" || conn.kubeconfigData != "" || conn.inCluster {
+			return fmt.Errorf("-kubeconfigs and -contexts cannot be used with -manifest, -watch, -serve, -split-by-namespace, -context, -kubeconfig-data or -in-cluster")
+		}
+		if len(opts.kubeconfigs) > 0 && conn.kubeconfigSet {
+			return fmt.Errorf("-kubeconfigs cannot be used with -kubeconfig, pass -contexts to scan several contexts of one kubeconfig")
+		}
+		if opts.clusterConcurrency < 1 {
+			return fmt.Errorf("-cluster-concurrency must be at least 1, got %d", opts.clusterConcurrency)
+		}
+		if opts.clusters, err = clusterTargets(conn, opts.kubeconfigs, opts.contexts); err != nil {
+			return err
+		}
+	}
+
+	// Manifests are checked without connecting to a cluster, and each cluster is connected to as it is scanned
+	var clientset kubernetes.Interface
+	switch {
+	case len(opts.clusters) > 0:
+	case opts.manifest != "":
+		if opts.gatewayAPI || opts.scan.UseEndpoints || opts.scan.OwnerLabel != "" {
+			return fmt.Errorf("-gateway-api, -use-endpoints and -owner-label cannot be used with -manifest")
+		}
+		opts.manifestObjects, err = scanner.LoadManifests(opts.manifest)
+		if err != nil {
+			return err
+		}
+	default:
+		connectCtx, cancelConnect := context.WithTimeout(context.Background(), opts.timeout)
+		c, err := connect(connectCtx, conn, opts.gatewayAPI)
+		cancelConnect()
+		if err != nil {
+			return err
+		}
+		clientset, opts.scan.GatewayClientset = c.clientset, c.gatewayClientset
+		opts.metadata.Context, opts.metadata.Server = c.context, c.server
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.outputFile != "" {
+		file, err := createOutputFile(opts.outputFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil {
+				slog.Error("Error whilst closing output file", "path", opts.outputFile, "err", closeErr)
 			}
-			results[svc.Namespace] = append(results[svc.Namespace], r)
+		}()
+		w = file
+	}
+
+	opts.color = opts.color && isTerminal(w)
+
+	if opts.watch {
+		return watch(w, clientset, opts)
+	}
+	if opts.serve != "" {
+		return serve(opts.serve, opts.serveInterval, clientset, opts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	if len(opts.clusters) > 0 {
+		// Each cluster is scanned with its own timeout
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	err = run(ctx, w, clientset, opts)
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+		return fmt.Errorf("scan timed out after %s, consider increasing -timeout", opts.timeout)
+	}
+	return err
+}
+
+// watch re-scans the cluster as resources change until interrupted, writing each new failure to w as it is found.
+// The timeout applies to each scan rather than to the whole watch.
+func watch(w io.Writer, clientset kubernetes.Interface, opts options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	write, writeErr := streamNDJSON(w)
+	if opts.output == outputText {
+		write = func(f scanner.Finding) {
+			fmt.Fprintln(w, f.Message())
 		}
 	}
 
-	totalResults := 0
-	for _, v := range results {
-		totalResults += len(v)
+	return errors.Join(scanner.Watch(ctx, clientset, opts.scan, scanner.WatchOptions{
+		Debounce:     opts.watchDebounce,
+		ScanTimeout:  opts.timeout,
+		OnNewFailure: write,
+	}), writeErr())
+}
+
+// cluster is a connection to the k8s API server.
+type cluster struct {
+	clientset        kubernetes.Interface
+	gatewayClientset gatewayclient.Interface // Nil unless the Gateway API is enabled
+	context          string                  // The kubeconfig context, or in-cluster
+	server           string                  // URL of the API server
+}
+
+// connect builds the k8s clientset, and the Gateway API clientset when gatewayAPI is set. ctx bounds the request made
+// to check impersonation.
+func connect(ctx context.Context, conn connectionOptions, gatewayAPI bool) (cluster, error) {
+	config, contextName, err := buildConfig(conn)
+	if err != nil {
+		return cluster{}, err
 	}
-	fmt.Printf("%d results (after filtering)\n\n", totalResults)
+	config = rateLimit(config, conn)
+	c := cluster{context: contextName, server: config.Host}
 
-	// Validate security contexts
-	err = checkSecurityContexts(clientset, results)
+	// create the clientset
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		return cluster{}, fmt.Errorf("error whilst creating the clientset: %w", authProviderError(err))
+	}
+	if err := checkImpersonation(ctx, clientset, conn); err != nil {
+		return cluster{}, err
+	}
+	c.clientset = clientset
+
+	if gatewayAPI {
+		c.gatewayClientset, err = gatewayclient.NewForConfig(config)
+		if err != nil {
+			return cluster{}, fmt.Errorf("error whilst creating the Gateway API clientset: %w", err)
+		}
 	}
+	return c, nil
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"query-security-contexts/scanner"
+)
+
+// pushgatewayJob is the job name the metrics are grouped under in the Pushgateway.
+const pushgatewayJob = "query_k8s_security_contexts"
+
+// pushMetrics pushes a gauge of the number of failing checks, labelled by namespace and check name, to the
+// Prometheus Pushgateway at url. When scanning several clusters, the gauge is also labelled by cluster, so namespaces
+// of the same name in different clusters are separate series. Checks which were evaluated but passed are pushed as
+// zero, so that a fix shows up as the series dropping rather than disappearing.
+func pushMetrics(ctx context.Context, url string, report []scanner.NamespaceFindings) error {
+	labels := []string{"namespace", "check"}
+	for _, ns := range report {
+		if ns.Cluster != "" {
+			labels = append(labels, "cluster")
+			break
+		}
+	}
+	failingChecks := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "queryk8s_failing_checks_total",
+		Help: "Number of failing security context checks found by the last scan.",
+	}, labels)
+
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			values := []string{ns.Namespace, f.Check}
+			if len(labels) > 2 {
+				values = append(values, ns.Cluster)
+			}
+			gauge := failingChecks.WithLabelValues(values...)
+			if f.Failed() {
+				gauge.Inc()
+			}
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(failingChecks)
+
+	if err := push.New(url, pushgatewayJob).Gatherer(registry).PushContext(ctx); err != nil {
+		return fmt.Errorf("error whilst pushing metrics to the Pushgateway: %w", err)
+	}
+	return nil
+}
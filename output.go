@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+	"sigs.k8s.io/yaml"
+
+	"query-security-contexts/scanner"
+)
+
+// Supported values for the -output flag.
+const (
+	outputText   = "text"
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputYAML   = "yaml"
+	outputCSV    = "csv"
+	outputSARIF  = "sarif"
+	outputJUnit  = "junit"
+)
+
+// approvedImageColumn returns whether the finding's image is approved for the CSV output, or an empty string if no
+// approved images were given.
+func approvedImageColumn(f scanner.Finding) string {
+	if f.ApprovedImage == nil {
+		return ""
+	}
+	return strconv.FormatBool(*f.ApprovedImage)
+}
+
+// createOutputFile creates the file at path for writing the findings, creating any parent directories and truncating
+// an existing file.
+func createOutputFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error whilst creating output directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst creating output file: %w", err)
+	}
+	return file, nil
+}
+
+// writeReport writes the findings to w in the given output format. When color is set, failures in the text and table
+// output are highlighted. When showPassed is set, the text output also lists the checks which passed. The metadata is
+// included in the JSON and YAML output.
+func writeReport(w io.Writer, output string, color, showPassed bool, metadata scanMetadata, report []scanner.NamespaceFindings) error {
+	switch output {
+	case outputText:
+		return writeText(w, report, color, showPassed)
+	case outputTable:
+		return writeTable(w, report, color)
+	case outputJSON:
+		return writeJSON(w, structuredReport{Metadata: metadata, Namespaces: report})
+	case outputNDJSON:
+		// Already streamed as the checks ran
+		return nil
+	case outputYAML:
+		return writeYAML(w, structuredReport{Metadata: metadata, Namespaces: report})
+	case outputCSV:
+		return writeCSV(w, report)
+	case outputSARIF:
+		return writeSARIF(w, report)
+	case outputJUnit:
+		return writeJUnit(w, report)
+	}
+	return nil
+}
+
+// severityOrder lists the severity levels from the most to the least severe, the order the text output is grouped in.
+var severityOrder = []string{scanner.SeverityCritical, scanner.SeverityHigh, scanner.SeverityMedium, scanner.SeverityLow}
+
+// ANSI escape sequences used to highlight failures.
+const (
+	ansiBoldRed = "\x1b[1;31m"
+	ansiRed     = "\x1b[31m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiReset   = "\x1b[0m"
+)
+
+// severityColors is the color of the failures of each severity in the text output.
+var severityColors = map[string]string{
+	scanner.SeverityCritical: ansiBoldRed,
+	scanner.SeverityHigh:     ansiRed,
+	scanner.SeverityMedium:   ansiYellow,
+	scanner.SeverityLow:      ansiCyan,
+}
+
+// writeText writes a console message for each failing check, grouped by severity with the most severe first, so
+// critical findings stand out. Each group has a heading with the number of failures and is followed by a blank line.
+// Within a group the findings keep the report's order, by namespace and then service. When color is set, each group
+// is colored by its severity. When showPassed is set, the checks which passed are listed in a final group, so the
+// output shows which services and containers were evaluated.
+func writeText(w io.Writer, report []scanner.NamespaceFindings, color, showPassed bool) error {
+	bySeverity := make(map[string][]scanner.Finding)
+	var passed []scanner.Finding
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Passed {
+				passed = append(passed, f)
+			}
+			if !f.Failed() {
+				continue
+			}
+			severity := f.Severity
+			if !scanner.ValidSeverity(severity) {
+				severity = scanner.SeverityMedium
+			}
+			bySeverity[severity] = append(bySeverity[severity], f)
+		}
+	}
+
+	var b strings.Builder
+	for _, severity := range severityOrder {
+		findings := bySeverity[severity]
+		if len(findings) == 0 {
+			continue
+		}
+		start, end := "", ""
+		if color {
+			start, end = severityColors[severity], ansiReset
+		}
+		fmt.Fprintf(&b, "%s%s (%d)%s\n", start, strings.ToUpper(severity), len(findings), end)
+		for _, f := range findings {
+			fmt.Fprintf(&b, "%s%s%s\n", start, f.Message(), end)
+		}
+		b.WriteString("\n")
+	}
+	if showPassed && len(passed) > 0 {
+		fmt.Fprintf(&b, "PASSED (%d)\n", len(passed))
+		for _, f := range passed {
+			fmt.Fprintln(&b, f.PassMessage())
+		}
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error whilst writing findings: %w", err)
+	}
+	return nil
+}
+
+// ANSI escape sequences used to highlight failures in the table output. They are wrapped in tabwriter.Escape
+// characters (\xff) so they do not count towards the column widths.
+const (
+	colorRed   = "\xff" + ansiRed + "\xff"
+	colorReset = "\xff" + ansiReset + "\xff"
+)
+
+// writeTable writes every finding as a row of aligned columns, for reading on a wide terminal.
+func writeTable(w io.Writer, report []scanner.NamespaceFindings, color bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.StripEscape)
+	fmt.Fprintln(tw, "NAMESPACE\tSERVICE\tTYPE\tPOD\tCONTAINER\tCHECK\tSTATUS")
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			status := f.Status()
+			if color && f.Failed() {
+				status = colorRed + status + colorReset
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.Namespace, orDash(f.Subject()), orDash(f.Type), orDash(f.Pod), orDash(f.Container), f.Check, status)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("error whilst writing table: %w", err)
+	}
+	return nil
+}
+
+// orDash returns s, or a dash if s is empty, so empty table cells are visible.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// isTerminal returns whether w is a terminal, so colors are only written when a person is reading the output.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// writeJSON writes the scan metadata and the findings, grouped by namespace, as a single JSON object.
+func writeJSON(w io.Writer, report structuredReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("error whilst encoding findings as JSON: %w", err)
+	}
+	return nil
+}
+
+// streamNDJSON returns a function which writes each finding to w as a single line of JSON (NDJSON), for streaming the
+// findings as they are found. Writing stops at the first error, which is returned by the second function.
+func streamNDJSON(w io.Writer) (func(scanner.Finding), func() error) {
+	encoder := json.NewEncoder(w)
+	var streamErr error
+	write := func(f scanner.Finding) {
+		if streamErr != nil {
+			return
+		}
+		if err := encoder.Encode(f); err != nil {
+			streamErr = fmt.Errorf("error whilst encoding finding as JSON: %w", err)
+		}
+	}
+	return write, func() error { return streamErr }
+}
+
+// writeYAML writes the scan metadata and the findings, grouped by namespace, as YAML. The field names match the JSON
+// output.
+func writeYAML(w io.Writer, report structuredReport) error {
+	out, err := yaml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error whilst encoding findings as YAML: %w", err)
+	}
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("error whilst writing YAML: %w", err)
+	}
+	return nil
+}
+
+// writeCSV writes the findings as CSV with a header row, one row per finding.
+func writeCSV(w io.Writer, report []scanner.NamespaceFindings) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"namespace", "service", "type", "ingress", "pod", "container", "check", "severity", "status", "image", "approvedImage", "ownerKind", "owner", "affectedPods", "fingerprint", "baseline", "namespaceOwner", "cluster"}); err != nil {
+		return fmt.Errorf("error whilst writing CSV header: %w", err)
+	}
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if err := writer.Write([]string{f.Namespace, f.Service, f.Type, f.Ingress, f.Pod, f.Container, f.Check, f.Severity, f.Status(), f.Image, approvedImageColumn(f), f.OwnerKind, f.Owner, f.AffectedReplicas(), f.Fingerprint, f.Baseline, f.NamespaceOwner, f.Cluster}); err != nil {
+				return fmt.Errorf("error whilst writing CSV row: %w", err)
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error whilst writing CSV: %w", err)
+	}
+	return nil
+}
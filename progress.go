@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// progressInterval is how often progress is logged when stderr is not a terminal.
+const progressInterval = 5 * time.Second
+
+// newProgress returns an OnProgress callback which reports how many services have been checked on stderr, so long
+// scans do not appear to hang. On a terminal a single line is rewritten after each service, otherwise progress is
+// logged every progressInterval. The returned finish func ends the progress line, e.g. when the scan stops early.
+func newProgress(stderr *os.File) (func(checked, total int), func()) {
+	if !isTerminal(stderr) {
+		var last time.Time
+		return func(checked, total int) {
+			if checked < total && time.Since(last) < progressInterval {
+				return
+			}
+			last = time.Now()
+			slog.Info("Progress", "checked", fmt.Sprintf("%d/%d", checked, total))
+		}, func() {}
+	}
+
+	written := false
+	progress := func(checked, total int) {
+		// Clear to the end of the line, as a log message may have been written over it
+		fmt.Fprintf(stderr, "\rChecked %d/%d services\x1b[K", checked, total)
+		written = true
+	}
+	finish := func() {
+		if written {
+			fmt.Fprintln(stderr)
+		}
+	}
+	return progress, finish
+}
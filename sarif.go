@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"query-security-contexts/scanner"
+)
+
+// The subset of the SARIF 2.1.0 format which is needed to report findings to GitHub code scanning.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           sarifProperties    `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifProperties struct {
+	SecuritySeverity string   `json:"security-severity"`
+	Tags             []string `json:"tags"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	BaselineState       string            `json:"baselineState,omitempty"` // new or unchanged, when compared with a baseline
+}
+
+// sarifFingerprintKey is the key of the finding's fingerprint in a result's partialFingerprints.
+const sarifFingerprintKey = "findingFingerprint/v1"
+
+// sarifBaselineStates maps the baseline status of a failure onto the SARIF baseline states.
+var sarifBaselineStates = map[string]string{
+	scanner.BaselineNew:      "new",
+	scanner.BaselineExisting: "unchanged",
+}
+
+// sarifSuppression marks a result as accepted, so code scanning does not raise an alert for it.
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevels maps the finding severities onto the SARIF result levels.
+var sarifLevels = map[string]string{
+	scanner.SeverityCritical: "error",
+	scanner.SeverityHigh:     "error",
+	scanner.SeverityMedium:   "warning",
+	scanner.SeverityLow:      "note",
+}
+
+// sarifSecuritySeverities maps the finding severities onto the numeric scores GitHub uses to rank security alerts.
+var sarifSecuritySeverities = map[string]string{
+	scanner.SeverityCritical: "9.5",
+	scanner.SeverityHigh:     "7.5",
+	scanner.SeverityMedium:   "5.0",
+	scanner.SeverityLow:      "2.5",
+}
+
+// buildSARIF converts the findings into a SARIF log. Each check which was evaluated becomes a rule, and each
+// failing finding becomes a result located at the namespaced resource it was found in.
+func buildSARIF(report []scanner.NamespaceFindings) sarifLog {
+	// The severity is taken from the findings, so custom policy rules have their own severity
+	severities := make(map[string]string)
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			severities[f.Check] = f.Severity
+		}
+	}
+	ruleIDs := make([]string, 0, len(severities))
+	for check := range severities {
+		ruleIDs = append(ruleIDs, check)
+	}
+	sort.Strings(ruleIDs)
+
+	rules := make([]sarifRule, 0, len(ruleIDs))
+	ruleIndexes := make(map[string]int, len(ruleIDs))
+	for i, id := range ruleIDs {
+		severity := severities[id]
+		description := scanner.CheckDescription(id)
+		if description == "" {
+			description = id
+		}
+		ruleIndexes[id] = i
+		rules = append(rules, sarifRule{
+			ID:                   id,
+			Name:                 id,
+			ShortDescription:     sarifMessage{Text: description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevels[severity]},
+			Properties: sarifProperties{
+				SecuritySeverity: sarifSecuritySeverities[severity],
+				Tags:             []string{"security", "kubernetes"},
+			},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Passed {
+				continue
+			}
+			result := sarifResult{
+				RuleID:    f.Check,
+				RuleIndex: ruleIndexes[f.Check],
+				Level:     sarifLevels[f.Severity],
+				Message:   sarifMessage{Text: f.Message()},
+				Locations: []sarifLocation{sarifFindingLocation(f)},
+
+				PartialFingerprints: map[string]string{sarifFingerprintKey: f.Fingerprint},
+				BaselineState:       sarifBaselineStates[f.Baseline],
+			}
+			if f.Accepted {
+				result.Suppressions = []sarifSuppression{{Kind: "external"}}
+			}
+			results = append(results, result)
+		}
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "query-security-contexts",
+				InformationURI: "https://github.com/michaelprice232/query-k8s-security-contexts",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+// sarifFindingLocation returns the location of a finding. There is no source file for a live cluster resource, so
+// the artifact URI is the namespaced path to the resource, e.g. payments/pod/web-7d9f8-x2k4q/container/app. When
+// scanning several clusters, the path starts with the cluster, e.g. prod/payments/pod/web-7d9f8-x2k4q.
+func sarifFindingLocation(f scanner.Finding) sarifLocation {
+	path := f.Namespace + "/pod/" + f.Pod
+	if f.Pod == "" {
+		path = f.Namespace + "/workload/" + f.Workload
+	}
+	if f.Container != "" {
+		path += "/container/" + f.Container
+	}
+	if f.Cluster != "" {
+		path = f.Cluster + "/" + path
+	}
+
+	return sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: path}},
+		LogicalLocations: []sarifLogicalLocation{{
+			Name:               f.Subject(),
+			FullyQualifiedName: path,
+			Kind:               "resource",
+		}},
+	}
+}
+
+// writeSARIF writes the findings as a SARIF 2.1.0 document.
+func writeSARIF(w io.Writer, report []scanner.NamespaceFindings) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(buildSARIF(report)); err != nil {
+		return fmt.Errorf("error whilst encoding findings as SARIF: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"query-security-contexts/scanner"
+)
+
+func TestBuildSARIF(t *testing.T) {
+	finding := func(check, severity string, passed, accepted bool) scanner.Finding {
+		return scanner.Finding{
+			Namespace: "payments", Service: "web", Pod: "web-1", Container: "app",
+			Check: check, Severity: severity, Passed: passed, Accepted: accepted, Fingerprint: check + "-fp",
+		}
+	}
+	report := []scanner.NamespaceFindings{{Namespace: "payments", Findings: []scanner.Finding{
+		finding(scanner.CheckRunAsNonRoot, scanner.SeverityMedium, false, true),
+		finding(scanner.CheckPrivileged, scanner.SeverityCritical, false, false),
+		finding(scanner.CheckHostNetwork, scanner.SeverityHigh, true, false),
+		finding("RunAsUserSet", scanner.SeverityLow, false, false), // A custom policy rule
+	}}}
+
+	run := buildSARIF(report).Runs[0]
+
+	// Every evaluated check is a rule, including those which passed, sorted by ID
+	wantRules := []string{scanner.CheckHostNetwork, scanner.CheckPrivileged, scanner.CheckRunAsNonRoot, "RunAsUserSet"}
+	if len(run.Tool.Driver.Rules) != len(wantRules) {
+		t.Fatalf("buildSARIF() rules = %+v, want %v", run.Tool.Driver.Rules, wantRules)
+	}
+	for i, rule := range run.Tool.Driver.Rules {
+		if rule.ID != wantRules[i] {
+			t.Errorf("rule %d = %s, want %s", i, rule.ID, wantRules[i])
+		}
+	}
+	if rule := run.Tool.Driver.Rules[3]; rule.DefaultConfiguration.Level != "note" || rule.ShortDescription.Text != "RunAsUserSet" {
+		t.Errorf("policy rule = %+v, want the note level of its severity and its name as the description", rule)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("buildSARIF() results = %+v, want one for each failure and none for passes", run.Results)
+	}
+	for _, result := range run.Results {
+		if rule := run.Tool.Driver.Rules[result.RuleIndex]; rule.ID != result.RuleID {
+			t.Errorf("result %s has ruleIndex %d of rule %s", result.RuleID, result.RuleIndex, rule.ID)
+		}
+		if result.PartialFingerprints[sarifFingerprintKey] != result.RuleID+"-fp" {
+			t.Errorf("result %s fingerprints = %v, want %s-fp", result.RuleID, result.PartialFingerprints, result.RuleID)
+		}
+		accepted := result.RuleID == scanner.CheckRunAsNonRoot
+		if got := len(result.Suppressions) == 1 && result.Suppressions[0].Kind == "external"; got != accepted {
+			t.Errorf("result %s suppressions = %+v, want suppressed %t", result.RuleID, result.Suppressions, accepted)
+		}
+		if uri := result.Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "payments/pod/web-1/container/app" {
+			t.Errorf("result %s URI = %s, want payments/pod/web-1/container/app", result.RuleID, uri)
+		}
+	}
+}
+
+func TestSARIFFindingLocationCluster(t *testing.T) {
+	location := sarifFindingLocation(scanner.Finding{Cluster: "prod", Namespace: "payments", Workload: "Deployment/web"})
+	if uri := location.PhysicalLocation.ArtifactLocation.URI; uri != "prod/payments/workload/Deployment/web" {
+		t.Errorf("sarifFindingLocation() URI = %s, want prod/payments/workload/Deployment/web", uri)
+	}
+}
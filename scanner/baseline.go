@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Status of a finding compared with a baseline report, as set in Finding.Baseline.
+const (
+	BaselineNew      = "new"      // A failure which was not failing in the baseline
+	BaselineExisting = "existing" // A failure which was also failing in the baseline
+	BaselineResolved = "resolved" // A failure in the baseline which no longer fails
+)
+
+// fingerprint returns a stable ID for the finding, from its namespace, owning workload, container and check, plus the
+// cluster when scanning several. It does not include the pod name, so it is the same across rollouts and between scans.
+func fingerprint(f Finding) string {
+	owner := f.OwnerKind + "/" + f.Owner
+	if f.Owner == "" {
+		// Findings which do not relate to a pod, such as a missing backend service
+		owner = f.Ingress + "/" + f.Service
+	}
+	parts := []string{f.Namespace, owner, f.Container, f.Check}
+	if f.Cluster != "" {
+		// Only prefixed when set, so the fingerprints of single cluster scans do not change
+		parts = append([]string{f.Cluster}, parts...)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// baselineReport is the subset of a JSON or YAML report which is read by LoadBaseline.
+type baselineReport struct {
+	Namespaces []NamespaceFindings `json:"namespaces"`
+}
+
+// Baseline holds the failures of a previous report, so each finding can be marked as new, existing or resolved.
+type Baseline struct {
+	failures     map[string]Finding // The failures in the baseline, keyed by fingerprint
+	fingerprints []string           // The keys of failures in the order they were reported, so output is stable
+}
+
+// LoadBaseline reads a previous report at path, as written by -output=json or -output=yaml. Failures accepted by an
+// exception are treated as failures, so accepting a failure does not show it as resolved.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst reading baseline report: %w", err)
+	}
+	var report baselineReport
+	if err := yaml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("error whilst parsing baseline report %s: %w", path, err)
+	}
+
+	b := &Baseline{failures: make(map[string]Finding)}
+	for _, ns := range report.Namespaces {
+		for _, f := range ns.Findings {
+			if f.Passed || f.Baseline == BaselineResolved {
+				continue
+			}
+			if f.Fingerprint == "" {
+				return nil, fmt.Errorf("baseline report %s has findings without a fingerprint, it must be written by a version of the tool which reports them", path)
+			}
+			if _, ok := b.failures[f.Fingerprint]; !ok {
+				b.fingerprints = append(b.fingerprints, f.Fingerprint)
+			}
+			b.failures[f.Fingerprint] = f
+		}
+	}
+	slog.Debug("Loaded baseline", "path", path, "failures", len(b.failures))
+	return b, nil
+}
+
+// status returns whether the finding is new, existing or resolved compared with the baseline, or an empty string for
+// findings which passed in both. A nil Baseline has no status.
+func (b *Baseline) status(f Finding) string {
+	if b == nil {
+		return ""
+	}
+	_, failed := b.failures[f.Fingerprint]
+	switch {
+	case !f.Passed && failed:
+		return BaselineExisting
+	case !f.Passed:
+		return BaselineNew
+	case failed:
+		return BaselineResolved
+	}
+	return ""
+}
+
+// addResolved adds the baseline's failures which are no longer reported at all, e.g. as the workload was deleted, to
+// the report as resolved. They are marked as passed, so they do not count as failures. Namespaces which were not
+// scanned, including those of other clusters, are left out, as their failures are unknown rather than resolved.
+func (b *Baseline) addResolved(report []NamespaceFindings) {
+	if b == nil {
+		return
+	}
+	reported := make(map[string]bool)
+	byNamespace := make(map[string]int, len(report))
+	counts := make(map[string]int)
+	for i, ns := range report {
+		byNamespace[ns.Cluster+"/"+ns.Namespace] = i
+		for _, f := range ns.Findings {
+			reported[f.Fingerprint] = true
+			if f.Baseline != "" {
+				counts[f.Baseline]++
+			}
+		}
+	}
+
+	for _, fp := range b.fingerprints {
+		f := b.failures[fp]
+		i, scanned := byNamespace[f.Cluster+"/"+f.Namespace]
+		if reported[fp] || !scanned {
+			continue
+		}
+		f.Passed, f.Accepted, f.Baseline = true, false, BaselineResolved
+		report[i].Findings = append(report[i].Findings, f)
+		counts[BaselineResolved]++
+	}
+	slog.Info("Compared findings with the baseline", "new", counts[BaselineNew], "existing", counts[BaselineExisting], "resolved", counts[BaselineResolved])
+}
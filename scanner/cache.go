@@ -0,0 +1,203 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podCache caches pod listings by namespace and label selector for the duration of a single scan, so that services
+// which share a selector only trigger a single List call. It is safe for concurrent use.
+type podCache struct {
+	clientset kubernetes.Interface
+	pageSize  int64
+
+	mu      sync.Mutex
+	entries map[string]*podCacheEntry
+}
+
+// podCacheEntry is a single cached pod listing. The once ensures concurrent callers for the same key wait on
+// a single List call rather than each making their own.
+type podCacheEntry struct {
+	once sync.Once
+	pods []corev1.Pod
+	err  error
+}
+
+// newPodCache returns an empty podCache which lists pods using clientset, pageSize pods at a time.
+func newPodCache(clientset kubernetes.Interface, pageSize int64) *podCache {
+	return &podCache{clientset: clientset, pageSize: pageSize, entries: make(map[string]*podCacheEntry)}
+}
+
+// list returns the pods in the namespace matching the label selector, listing them from the API on first use.
+func (c *podCache) list(ctx context.Context, namespace, selector string) ([]corev1.Pod, error) {
+	key := namespace + "/" + selector
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &podCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		pods, err := listAll(c.pageSize, metav1.ListOptions{LabelSelector: selector}, func(o metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, o)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+		if err != nil {
+			entry.err = fmt.Errorf("error whilst listing pods: %w", err)
+			return
+		}
+		entry.pods = pods
+	})
+
+	return entry.pods, entry.err
+}
+
+// endpointPods returns the pods targeted by the EndpointSlices of the service, filtered from the cached listing of every
+// pod in the namespace, so services with manually managed endpoints or a selector which does not match the ready pods
+// are checked accurately. The 2nd return value is false when the service has no EndpointSlices.
+func (c *podCache) endpointPods(ctx context.Context, namespace, service string) ([]corev1.Pod, bool, error) {
+	selector := labels.Set{discoveryv1.LabelServiceName: service}.String()
+	slices, err := listAll(c.pageSize, metav1.ListOptions{LabelSelector: selector}, func(o metav1.ListOptions) ([]discoveryv1.EndpointSlice, string, error) {
+		list, err := c.clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error whilst listing EndpointSlices: %w", err)
+	}
+	if len(slices) == 0 {
+		return nil, false, nil
+	}
+
+	targets := make(map[string]bool)
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			ref := endpoint.TargetRef
+			if ref != nil && ref.Kind == "Pod" && (ref.Namespace == "" || ref.Namespace == namespace) {
+				targets[ref.Name] = true
+			}
+		}
+	}
+
+	all, err := c.list(ctx, namespace, "")
+	if err != nil {
+		return nil, true, err
+	}
+	pods := make([]corev1.Pod, 0, len(targets))
+	for _, pod := range all {
+		if targets[pod.Name] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, true, nil
+}
+
+// onceCache caches objects of type T by namespace and name for the duration of a single scan, so objects shared by
+// many pods, such as service accounts and ReplicaSets, are only got from the API once. It is safe for concurrent use.
+type onceCache[T any] struct {
+	kind  string // The kind of object, used in errors, e.g. ReplicaSet
+	fetch func(ctx context.Context, namespace, name string) (*T, error)
+
+	mu      sync.Mutex
+	entries map[string]*onceCacheEntry[T]
+}
+
+// onceCacheEntry is a single cached object. The once ensures concurrent callers for the same key wait on a single Get
+// call rather than each making their own. The object is nil if it does not exist.
+type onceCacheEntry[T any] struct {
+	once   sync.Once
+	object *T
+	err    error
+}
+
+// newOnceCache returns an empty onceCache which gets objects of the kind using fetch.
+func newOnceCache[T any](kind string, fetch func(ctx context.Context, namespace, name string) (*T, error)) *onceCache[T] {
+	return &onceCache[T]{kind: kind, fetch: fetch, entries: make(map[string]*onceCacheEntry[T])}
+}
+
+// get returns the named object, getting it from the API on first use. A nil object is returned without an error if it
+// does not exist, e.g. a ReplicaSet which has been deleted after a rollout. The namespace is empty for cluster scoped
+// objects.
+func (c *onceCache[T]) get(ctx context.Context, namespace, name string) (*T, error) {
+	key := namespace + "/" + name
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &onceCacheEntry[T]{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		object, err := c.fetch(ctx, namespace, name)
+		if k8sErrors.IsNotFound(err) {
+			return
+		}
+		if err != nil {
+			entry.err = fmt.Errorf("error whilst getting %s: %w", c.kind, err)
+			return
+		}
+		entry.object = object
+	})
+
+	return entry.object, entry.err
+}
+
+// newServiceAccountCache returns a cache of the service accounts got using clientset. A pod's service account may not
+// exist, e.g. when checking the pod template of a workload which cannot be scheduled.
+func newServiceAccountCache(clientset kubernetes.Interface) *onceCache[corev1.ServiceAccount] {
+	return newOnceCache("service account", func(ctx context.Context, namespace, name string) (*corev1.ServiceAccount, error) {
+		return clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+}
+
+// newReplicaSetCache returns a cache of the ReplicaSets got using clientset, as every replica of a Deployment shares a
+// ReplicaSet.
+func newReplicaSetCache(clientset kubernetes.Interface) *onceCache[appsv1.ReplicaSet] {
+	return newOnceCache("ReplicaSet", func(ctx context.Context, namespace, name string) (*appsv1.ReplicaSet, error) {
+		return clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+}
+
+// newNamespaceCache returns a cache of the namespaces got using clientset, as every service in a namespace shares it.
+// The namespace is only used to annotate the findings, so when getting it is forbidden this is logged, once per
+// namespace, and it is treated as not existing rather than dropping the namespace's findings.
+func newNamespaceCache(clientset kubernetes.Interface) *onceCache[corev1.Namespace] {
+	return newOnceCache("namespace", func(ctx context.Context, _, name string) (*corev1.Namespace, error) {
+		ns, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if k8sErrors.IsForbidden(err) {
+			slog.Warn("Access to the namespace is forbidden, leaving its owner empty", "namespace", name, "err", err)
+			return nil, nil
+		}
+		return ns, err
+	})
+}
+
+// namespaceOwner returns the value of the label on the named namespace, or an empty string when the label or the
+// namespace does not exist.
+func namespaceOwner(ctx context.Context, namespaces *onceCache[corev1.Namespace], name, label string) (string, error) {
+	ns, err := namespaces.get(ctx, "", name)
+	if err != nil || ns == nil {
+		return "", err
+	}
+	return ns.Labels[label], nil
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// podLists returns the number of pod List calls made to the clientset.
+func podLists(clientset *fake.Clientset) int {
+	lists := 0
+	for _, action := range clientset.Actions() {
+		if action.Matches("list", "pods") {
+			lists++
+		}
+	}
+	return lists
+}
+
+func TestPodCacheList(t *testing.T) {
+	clientset := newClientset(newPod("web-1", "web", corev1.PodRunning), newPod("api-1", "api", corev1.PodRunning))
+	cache := newPodCache(clientset, 0)
+
+	for i := 0; i < 2; i++ {
+		pods, err := cache.list(context.Background(), testNamespace, "app=web")
+		if err != nil {
+			t.Fatalf("list() error = %v", err)
+		}
+		if len(pods) != 1 || pods[0].Name != "web-1" {
+			t.Errorf("list() = %v, want [web-1]", pods)
+		}
+	}
+	if got := podLists(clientset); got != 1 {
+		t.Errorf("pods listed %d times, want 1", got)
+	}
+
+	if _, err := cache.list(context.Background(), testNamespace, "app=api"); err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+	if got := podLists(clientset); got != 2 {
+		t.Errorf("pods listed %d times after a different selector, want 2", got)
+	}
+}
+
+func TestScanListsSharedSelectorOnce(t *testing.T) {
+	clientset := newClientset(
+		newIngress("web", httpRule(serviceBackend("web"), serviceBackend("web-canary"))),
+		newService("web", "web"),
+		newService("web-canary", "web"),
+		newPod("web-1", "web", corev1.PodRunning),
+	)
+
+	if _, err := Scan(context.Background(), clientset, Options{Namespace: testNamespace}); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := podLists(clientset); got != 1 {
+		t.Errorf("pods listed %d times for two services with the same selector, want 1", got)
+	}
+}
+
+func TestOnceCacheGet(t *testing.T) {
+	clientset := newClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace}})
+	serviceAccounts := newServiceAccountCache(clientset)
+
+	for i := 0; i < 2; i++ {
+		sa, err := serviceAccounts.get(context.Background(), testNamespace, "web")
+		if err != nil || sa == nil || sa.Name != "web" {
+			t.Errorf("get() = %v, %v, want the web service account", sa, err)
+		}
+	}
+	if sa, err := serviceAccounts.get(context.Background(), testNamespace, "missing"); err != nil || sa != nil {
+		t.Errorf("get() of a missing service account = %v, %v, want nil, nil", sa, err)
+	}
+	gets := 0
+	for _, action := range clientset.Actions() {
+		if action.Matches("get", "serviceaccounts") {
+			gets++
+		}
+	}
+	if gets != 2 {
+		t.Errorf("service accounts got %d times, want 2", gets)
+	}
+}
+
+func TestScanNamespaceOwnerForbidden(t *testing.T) {
+	clientset := newClientset(newIngress("web", httpRule(serviceBackend("web"))), newService("web", "web"), newPod("web-1", "web", corev1.PodRunning))
+	clientset.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, testNamespace, nil)
+	})
+
+	// All namespaces are scanned, so the namespace is only got to look up its owner
+	report, err := Scan(context.Background(), clientset, Options{OwnerLabel: "team", SkipForbidden: true, Checks: CheckSet{CheckRunAsNonRoot: true}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	f, ok := findingFor(report, CheckRunAsNonRoot)
+	if !ok {
+		t.Fatalf("Scan() = %+v, want the namespace's findings to be kept", report)
+	}
+	if f.NamespaceOwner != "" {
+		t.Errorf("Scan() namespace owner = %q, want it empty", f.NamespaceOwner)
+	}
+}
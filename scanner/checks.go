@@ -0,0 +1,1034 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Names of the individual security context checks, as used in structured output.
+const (
+	CheckPrivileged                 = "Privileged"
+	CheckRunAsNonRoot               = "RunAsNonRoot"
+	CheckRunAsUserRoot              = "RunAsUserRoot"
+	CheckRunAsNonRootConflict       = "RunAsNonRootConflict"
+	CheckAllowPrivilegeEscalation   = "AllowPrivilegeEscalation"
+	CheckReadOnlyRootFilesystem     = "ReadOnlyRootFilesystem"
+	CheckDropAllCapabilities        = "DropAllCapabilities"
+	CheckDangerousCapabilities      = "DangerousCapabilities"
+	CheckWritableHostPath           = "WritableHostPath"
+	CheckSensitiveHostPath          = "SensitiveHostPath"
+	CheckSensitiveHostPathVolume    = "SensitiveHostPathVolume"
+	CheckHostPort                   = "HostPort"
+	CheckProcMount                  = "ProcMount"
+	CheckHostNetwork                = "HostNetwork"
+	CheckHostPID                    = "HostPID"
+	CheckHostIPC                    = "HostIPC"
+	CheckSeccompProfile             = "SeccompProfile"
+	CheckUnsafeSysctls              = "UnsafeSysctls"
+	CheckServiceAccountToken        = "AutomountServiceAccountToken"
+	CheckUnboundedMemoryEmptyDir    = "UnboundedMemoryEmptyDir"
+	CheckResourceLimits             = "ResourceLimits"
+	CheckLatestImageTag             = "LatestImageTag"
+	CheckFSGroup                    = "FSGroup"
+	CheckZeroTerminationGracePeriod = "ZeroTerminationGracePeriod"
+	CheckMissingProbes              = "MissingProbes"
+	CheckWindowsHostProcess         = "WindowsHostProcess"
+	CheckWindowsRunAsUserName       = "WindowsRunAsUserName"
+	CheckBackendServiceNotFound     = "BackendServiceNotFound"
+)
+
+// Severity levels of the findings.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// severityRanks orders the severity levels, with the most severe having the highest rank.
+var severityRanks = map[string]int{
+	SeverityCritical: 4,
+	SeverityHigh:     3,
+	SeverityMedium:   2,
+	SeverityLow:      1,
+}
+
+// checkSeverities is the severity of a failure for each check.
+var checkSeverities = map[string]string{
+	CheckPrivileged:                 SeverityCritical,
+	CheckWindowsHostProcess:         SeverityCritical,
+	CheckSensitiveHostPath:          SeverityCritical,
+	CheckWritableHostPath:           SeverityHigh,
+	CheckSensitiveHostPathVolume:    SeverityHigh,
+	CheckProcMount:                  SeverityHigh,
+	CheckHostPID:                    SeverityHigh,
+	CheckHostIPC:                    SeverityHigh,
+	CheckHostNetwork:                SeverityHigh,
+	CheckUnsafeSysctls:              SeverityHigh,
+	CheckDangerousCapabilities:      SeverityHigh,
+	CheckAllowPrivilegeEscalation:   SeverityHigh,
+	CheckRunAsUserRoot:              SeverityHigh,
+	CheckRunAsNonRoot:               SeverityMedium,
+	CheckRunAsNonRootConflict:       SeverityMedium,
+	CheckDropAllCapabilities:        SeverityMedium,
+	CheckHostPort:                   SeverityMedium,
+	CheckSeccompProfile:             SeverityMedium,
+	CheckServiceAccountToken:        SeverityMedium,
+	CheckWindowsRunAsUserName:       SeverityMedium,
+	CheckReadOnlyRootFilesystem:     SeverityLow,
+	CheckUnboundedMemoryEmptyDir:    SeverityLow,
+	CheckResourceLimits:             SeverityLow,
+	CheckLatestImageTag:             SeverityLow,
+	CheckFSGroup:                    SeverityLow,
+	CheckZeroTerminationGracePeriod: SeverityLow,
+	CheckMissingProbes:              SeverityLow,
+	CheckBackendServiceNotFound:     SeverityMedium,
+}
+
+// checkDescriptions is a short description of what each check requires, used when describing the checks.
+var checkDescriptions = map[string]string{
+	CheckPrivileged:                 "Containers must not run as privileged",
+	CheckRunAsNonRoot:               "Pods must set RunAsNonRoot to true",
+	CheckRunAsUserRoot:              "Pods and containers must not explicitly set RunAsUser to 0",
+	CheckRunAsNonRootConflict:       "Containers must not set RunAsNonRoot to true whilst running as RunAsUser 0",
+	CheckAllowPrivilegeEscalation:   "Containers must set AllowPrivilegeEscalation to false",
+	CheckReadOnlyRootFilesystem:     "Containers must set ReadOnlyRootFilesystem to true",
+	CheckDropAllCapabilities:        "Containers must drop ALL capabilities",
+	CheckDangerousCapabilities:      "Containers must not add dangerous capabilities such as SYS_ADMIN or NET_ADMIN",
+	CheckWritableHostPath:           "Containers must mount hostPath volumes read-only",
+	CheckSensitiveHostPath:          "Containers must not mount sensitive host paths such as the container runtime socket read-write",
+	CheckSensitiveHostPathVolume:    "Pods must not have hostPath volumes of sensitive host paths such as /etc or the container runtime socket, even mounted read-only",
+	CheckHostPort:                   "Containers must not bind a hostPort",
+	CheckProcMount:                  "Containers must not set procMount to Unmasked",
+	CheckHostNetwork:                "Pods must not use the host network namespace",
+	CheckHostPID:                    "Pods must not use the host PID namespace",
+	CheckHostIPC:                    "Pods must not use the host IPC namespace",
+	CheckSeccompProfile:             "Pods must use the RuntimeDefault or Localhost seccomp profile",
+	CheckUnsafeSysctls:              "Pods must only set sysctls on the kubelet's safe list",
+	CheckServiceAccountToken:        "Pods must not automatically mount the service account token",
+	CheckUnboundedMemoryEmptyDir:    "Memory backed emptyDir volumes must set a sizeLimit",
+	CheckResourceLimits:             "Containers must set CPU and memory limits",
+	CheckLatestImageTag:             "Containers must reference an image by a tag other than latest, or by digest",
+	CheckFSGroup:                    "Pods must not set fsGroup or supplementalGroups to 0, and should set fsGroupChangePolicy to OnRootMismatch",
+	CheckZeroTerminationGracePeriod: "Pods must not set terminationGracePeriodSeconds to 0",
+	CheckMissingProbes:              "Containers must define a readinessProbe and a livenessProbe",
+	CheckWindowsHostProcess:         "Windows pods and containers must not run as HostProcess",
+	CheckWindowsRunAsUserName:       "Windows containers must set runAsUserName to a non-administrator account",
+	CheckBackendServiceNotFound:     "Ingress backends must reference a service which exists",
+}
+
+// CheckDescription returns a short description of what the check requires.
+func CheckDescription(check string) string {
+	return checkDescriptions[check]
+}
+
+// ValidSeverity returns whether severity is one of the supported severity levels.
+func ValidSeverity(severity string) bool {
+	_, ok := severityRanks[severity]
+	return ok
+}
+
+// CheckSeverity returns the severity of a failure for the check, defaulting to medium.
+func CheckSeverity(check string) string {
+	if s, ok := checkSeverities[check]; ok {
+		return s
+	}
+	return SeverityMedium
+}
+
+// dangerousCapabilities are the Linux capabilities which should not be added back to a container, as they
+// grant enough access to the host or other workloads to break out of the container's isolation.
+var dangerousCapabilities = map[string]bool{
+	"SYS_ADMIN":       true,
+	"NET_ADMIN":       true,
+	"SYS_PTRACE":      true,
+	"SYS_MODULE":      true,
+	"SYS_RAWIO":       true,
+	"SYS_BOOT":        true,
+	"SYS_TIME":        true,
+	"DAC_READ_SEARCH": true,
+	"BPF":             true,
+	"PERFMON":         true,
+	"ALL":             true,
+}
+
+// podContext is the pod being checked, along with anything the checks need which was looked up from the API.
+type podContext struct {
+	pod            corev1.Pod
+	os             corev1.OSName          // The OS the pod runs on, see podOS
+	serviceAccount *corev1.ServiceAccount // Nil if the service account does not exist or was not looked up
+	containers     []typedContainer
+	compliance     Compliance // What counts as passing for the configurable checks
+}
+
+// securityCheck is a single check, addressable by its stable name. A check runs at the pod level, the container
+// level or both. Each function returns whether the check passed, any detail about a failure, and whether the check
+// applies at all, e.g. the container level seccomp check only applies when the container overrides the pod's profile.
+// Opt-in checks are only run when explicitly named in -checks. The severity of the built-in checks is defined in
+// checkSeverities, so it is only set for custom policy rules. Checks of settings which only exist on one OS, such as
+// Linux capabilities, set os so they are skipped for pods running on another. Likewise, checks of settings which only
+// some types of container support, such as probes, set containerType.
+type securityCheck struct {
+	name          string
+	optIn         bool
+	severity      string
+	os            corev1.OSName // The OS of the pods the check applies to. Empty for every OS
+	containerType string        // The type of container the container level check applies to. Empty for every type
+	pod           func(p podContext) (passed bool, detail string, applies bool)
+	container     func(p podContext, c corev1.Container) (passed bool, detail string, applies bool)
+}
+
+// securityChecks are the checks run against each pod and its containers, in the order they are reported.
+var securityChecks = []securityCheck{
+	{name: CheckPrivileged, container: containerPrivileged, os: corev1.Linux},
+	{name: CheckWindowsHostProcess, pod: podWindowsHostProcess, container: containerWindowsHostProcess, os: corev1.Windows},
+	{name: CheckRunAsNonRoot, pod: podRunAsNonRoot, os: corev1.Linux},
+	{name: CheckRunAsUserRoot, pod: podRunAsUserRoot, container: containerRunAsUserRoot, os: corev1.Linux},
+	{name: CheckRunAsNonRootConflict, container: containerRunAsNonRootConflict, os: corev1.Linux},
+	{name: CheckWindowsRunAsUserName, container: containerWindowsRunAsUserName, os: corev1.Windows},
+	{name: CheckHostNetwork, pod: podHostNetwork},
+	{name: CheckHostPID, pod: podHostPID, os: corev1.Linux},
+	{name: CheckHostIPC, pod: podHostIPC, os: corev1.Linux},
+	{name: CheckSeccompProfile, pod: podSeccompProfile, container: containerSeccompProfile, os: corev1.Linux},
+	{name: CheckUnsafeSysctls, pod: podUnsafeSysctls, os: corev1.Linux},
+	{name: CheckServiceAccountToken, pod: podServiceAccountToken},
+	{name: CheckAllowPrivilegeEscalation, container: containerAllowPrivilegeEscalation, os: corev1.Linux},
+	{name: CheckReadOnlyRootFilesystem, container: containerReadOnlyRootFilesystem, os: corev1.Linux},
+	{name: CheckDropAllCapabilities, container: containerDropAllCapabilities, os: corev1.Linux},
+	{name: CheckDangerousCapabilities, container: containerDangerousCapabilities, os: corev1.Linux},
+	{name: CheckWritableHostPath, container: containerWritableHostPath},
+	{name: CheckSensitiveHostPath, container: containerSensitiveHostPath, os: corev1.Linux},
+	{name: CheckSensitiveHostPathVolume, pod: podSensitiveHostPathVolume, os: corev1.Linux},
+	{name: CheckHostPort, container: containerHostPort},
+	{name: CheckProcMount, container: containerProcMount, os: corev1.Linux},
+	{name: CheckUnboundedMemoryEmptyDir, pod: podUnboundedMemoryEmptyDir, optIn: true},
+	{name: CheckResourceLimits, container: containerResourceLimits, optIn: true},
+	{name: CheckLatestImageTag, container: containerLatestImageTag, optIn: true},
+	{name: CheckFSGroup, pod: podFSGroup, optIn: true, os: corev1.Linux},
+	{name: CheckZeroTerminationGracePeriod, pod: podZeroTerminationGracePeriod, optIn: true},
+	{name: CheckMissingProbes, container: containerMissingProbes, optIn: true, containerType: containerTypeContainer},
+}
+
+// CheckSet is the set of check names which are enabled for a scan. A nil CheckSet enables all checks.
+type CheckSet map[string]bool
+
+// Enabled returns whether the named check should be run.
+func (s CheckSet) Enabled(check string) bool {
+	return s == nil || s[check]
+}
+
+// DefaultChecks returns the checks which are run when none are explicitly chosen, which is every check except the
+// opt-in checks.
+func DefaultChecks() CheckSet {
+	enabled := make(CheckSet, len(securityChecks))
+	for _, check := range securityChecks {
+		if !check.optIn {
+			enabled[check.name] = true
+		}
+	}
+	return enabled
+}
+
+// ParseChecks parses the comma separated, case insensitive list of check names passed to -checks, or to -fail-on,
+// which also accepts the names of the policy's custom rules. An empty value enables the default checks.
+func ParseChecks(value string, policy *Policy) (CheckSet, error) {
+	checks := append(append([]securityCheck(nil), securityChecks...), policy.securityChecks()...)
+	byID := make(map[string]string, len(checks))
+	ids := make([]string, 0, len(checks))
+	for _, check := range checks {
+		byID[strings.ToLower(check.name)] = check.name
+		ids = append(ids, strings.ToLower(check.name))
+	}
+
+	if strings.TrimSpace(value) == "" {
+		return DefaultChecks(), nil
+	}
+	enabled := make(CheckSet, len(securityChecks))
+	for _, id := range strings.Split(value, ",") {
+		name, ok := byID[strings.ToLower(strings.TrimSpace(id))]
+		if !ok {
+			return nil, fmt.Errorf("unknown check %q, must be one of: %s", strings.TrimSpace(id), strings.Join(ids, ", "))
+		}
+		enabled[name] = true
+	}
+	return enabled, nil
+}
+
+// sensitiveHostPaths are the host paths which expose the node's credentials, kernel interfaces or container runtime,
+// giving control of the node or every container on it. They are sensitive even when mounted read-only, e.g. a
+// read-only runtime socket can still be used to start a privileged container. Each path also matches everything
+// beneath it, except / which only matches itself.
+var sensitiveHostPaths = []string{
+	"/",
+	"/boot",
+	"/dev",
+	"/etc",
+	"/proc",
+	"/root",
+	"/sys",
+	"/var/lib/kubelet",
+	"/var/lib/etcd",
+	"/var/lib/docker",
+	"/var/lib/containerd",
+	"/var/run",
+	"/run",
+}
+
+// enabledChecks returns the built-in checks which are enabled, followed by the custom policy rules.
+func enabledChecks(enabled CheckSet, policy *Policy) []securityCheck {
+	var checks []securityCheck
+	for _, check := range securityChecks {
+		if enabled.Enabled(check.name) {
+			checks = append(checks, check)
+		}
+	}
+	return append(checks, policy.securityChecks()...)
+}
+
+// checkPod runs the security context checks against a single pod, returning a finding for each check.
+// When checking a workload's pod template, the pod has no name and the findings reference the workload instead.
+// serviceAccount is the pod's service account, or nil if it does not exist, and is only used by the service account
+// token check. compliance configures what counts as passing for the configurable checks.
+func checkPod(r Result, pod corev1.Pod, serviceAccount *corev1.ServiceAccount, checks []securityCheck, compliance Compliance) []Finding {
+	var findings []Finding
+
+	workload := ""
+	if r.Template != nil {
+		workload = r.WorkloadKind + "/" + r.Name
+	}
+
+	p := podContext{pod: pod, os: podOS(pod), serviceAccount: serviceAccount, containers: podContainers(pod), compliance: compliance}
+	images := podImages(p.containers)
+
+	addFinding := func(check securityCheck, c typedContainer, passed bool, detail string) {
+		// Pod level findings relate to every container, so reference all of the pod's images
+		image := c.container.Image
+		if c.container.Name == "" {
+			image = images
+		}
+		severity := check.severity
+		if severity == "" {
+			severity = CheckSeverity(check.name)
+		}
+		findings = append(findings, Finding{
+			Namespace:     r.Namespace,
+			Service:       r.BackendService,
+			Type:          r.Type,
+			Ingress:       r.ingressName(),
+			Workload:      workload,
+			Pod:           pod.Name,
+			Container:     c.container.Name,
+			ContainerType: c.containerType,
+			Image:         image,
+			Check:         check.name,
+			Severity:      severity,
+			Passed:        passed,
+			Detail:        detail,
+		})
+	}
+
+	// Skip the checks of settings which do not exist on the pod's OS, e.g. capabilities on Windows
+	var applicable []securityCheck
+	for _, check := range checks {
+		if check.os == "" || check.os == p.os {
+			applicable = append(applicable, check)
+		}
+	}
+
+	for _, check := range applicable {
+		if check.pod == nil {
+			continue
+		}
+		if passed, detail, applies := check.pod(p); applies {
+			addFinding(check, typedContainer{}, passed, detail)
+		}
+	}
+	for _, c := range p.containers {
+		for _, check := range applicable {
+			if check.container == nil || (check.containerType != "" && check.containerType != c.containerType) {
+				continue
+			}
+			if passed, detail, applies := check.container(p, c.container); applies {
+				addFinding(check, c, passed, detail)
+			}
+		}
+	}
+
+	return findings
+}
+
+func containerPrivileged(_ podContext, c corev1.Container) (bool, string, bool) {
+	sc := c.SecurityContext
+	return sc == nil || sc.Privileged == nil || !*sc.Privileged, "", true
+}
+
+// podWindowsHostProcess checks the pod is not a Windows HostProcess pod, which runs directly on the host with full
+// access to it. It is the Windows equivalent of a privileged container.
+func podWindowsHostProcess(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	return sc == nil || !isHostProcess(sc.WindowsOptions), "", true
+}
+
+// containerWindowsHostProcess is only reported when the container overrides the pod's HostProcess flag.
+func containerWindowsHostProcess(_ podContext, c corev1.Container) (bool, string, bool) {
+	if c.SecurityContext == nil || c.SecurityContext.WindowsOptions == nil || c.SecurityContext.WindowsOptions.HostProcess == nil {
+		return false, "", false
+	}
+	return !isHostProcess(c.SecurityContext.WindowsOptions), "", true
+}
+
+// windowsAdministrators are the lower case names of the Windows accounts which have administrator access to the
+// container, or to the host when running as HostProcess.
+var windowsAdministrators = map[string]bool{
+	"containeradministrator": true,
+	"administrator":          true,
+	"nt authority\\system":   true,
+}
+
+// runAsUserNameUnset is the detail of a failed WindowsRunAsUserName check when no user name is set.
+const runAsUserNameUnset = "unset"
+
+// containerWindowsRunAsUserName checks the container runs as a non-administrator account such as ContainerUser. As
+// on Linux, the container's setting takes precedence over the pod's. When neither is set the image's default user is
+// used, which is ContainerAdministrator for many images, so an unset name also fails. The detail is the effective
+// user name, or unset.
+func containerWindowsRunAsUserName(p podContext, c corev1.Container) (bool, string, bool) {
+	var userName *string
+	if sc := p.pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil {
+		userName = sc.WindowsOptions.RunAsUserName
+	}
+	if sc := c.SecurityContext; sc != nil && sc.WindowsOptions != nil && sc.WindowsOptions.RunAsUserName != nil {
+		userName = sc.WindowsOptions.RunAsUserName
+	}
+	if userName == nil || *userName == "" {
+		return false, runAsUserNameUnset, true
+	}
+	return !windowsAdministrators[strings.ToLower(*userName)], *userName, true
+}
+
+// podRunAsNonRoot checks the pod sets RunAsNonRoot, or, when compliance.RunAsNonRoot.MinRunAsUser is set, that every
+// container runs as a user at or above it.
+func podRunAsNonRoot(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	if sc != nil && sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+		return true, "", true
+	}
+
+	minUser := p.compliance.RunAsNonRoot.MinRunAsUser
+	if minUser <= 0 {
+		return false, "", true
+	}
+	var podUser *int64
+	if sc != nil {
+		podUser = sc.RunAsUser
+	}
+	for _, c := range p.containers {
+		user := podUser
+		if c.container.SecurityContext != nil && c.container.SecurityContext.RunAsUser != nil {
+			user = c.container.SecurityContext.RunAsUser
+		}
+		if user == nil || *user < minUser {
+			return false, "", true
+		}
+	}
+	return true, "", true
+}
+
+// podRunAsUserRoot checks the pod does not explicitly request UID 0. This is worse than not requiring a non-root user,
+// so it is reported separately to RunAsNonRoot.
+func podRunAsUserRoot(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	return sc == nil || !isRootUser(sc.RunAsUser), "", true
+}
+
+// containerRunAsUserRoot is only reported when the container overrides the pod's user.
+func containerRunAsUserRoot(_ podContext, c corev1.Container) (bool, string, bool) {
+	if c.SecurityContext == nil || c.SecurityContext.RunAsUser == nil {
+		return false, "", false
+	}
+	return !isRootUser(c.SecurityContext.RunAsUser), "", true
+}
+
+// containerRunAsNonRootConflict checks the effective settings of the container, as the kubelet refuses to start a
+// container which requires a non-root user but runs as UID 0. Container settings take precedence over the pod's.
+func containerRunAsNonRootConflict(p podContext, c corev1.Container) (bool, string, bool) {
+	var runAsUser *int64
+	var runAsNonRoot *bool
+	if sc := p.pod.Spec.SecurityContext; sc != nil {
+		runAsUser, runAsNonRoot = sc.RunAsUser, sc.RunAsNonRoot
+	}
+	if sc := c.SecurityContext; sc != nil {
+		if sc.RunAsUser != nil {
+			runAsUser = sc.RunAsUser
+		}
+		if sc.RunAsNonRoot != nil {
+			runAsNonRoot = sc.RunAsNonRoot
+		}
+	}
+	return runAsNonRoot == nil || !*runAsNonRoot || !isRootUser(runAsUser), "", true
+}
+
+// podHostNetwork, podHostPID and podHostIPC check the pod does not share the host namespaces, which bypasses the pod's
+// isolation from the node.
+func podHostNetwork(p podContext) (bool, string, bool) { return !p.pod.Spec.HostNetwork, "", true }
+func podHostPID(p podContext) (bool, string, bool)     { return !p.pod.Spec.HostPID, "", true }
+func podHostIPC(p podContext) (bool, string, bool)     { return !p.pod.Spec.HostIPC, "", true }
+
+// safeSysctls are the sysctls which the kubelet allows by default, as they are namespaced and cannot affect other pods
+// on the node. See https://kubernetes.io/docs/tasks/administer-cluster/sysctl-cluster/#safe-and-unsafe-sysctls
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+}
+
+// normaliseSysctl returns the sysctl name with dots as the separator, as the kubelet also accepts slashes.
+func normaliseSysctl(name string) string {
+	return strings.ReplaceAll(name, "/", ".")
+}
+
+// podUnsafeSysctls checks the pod only sets sysctls on the kubelet's safe list, or which have been allowed, as unsafe
+// sysctls can weaken the kernel's protections for every pod on the node. The detail lists each unsafe name=value.
+func podUnsafeSysctls(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	if sc == nil {
+		return true, "", true
+	}
+	var unsafe []string
+	for _, s := range sc.Sysctls {
+		name := normaliseSysctl(s.Name)
+		if safeSysctls[name] || p.compliance.UnsafeSysctls.allowsSysctl(name) {
+			continue
+		}
+		unsafe = append(unsafe, s.Name+"="+s.Value)
+	}
+	return len(unsafe) == 0, strings.Join(unsafe, ","), true
+}
+
+// podUnboundedMemoryEmptyDir checks memory backed emptyDir volumes set a sizeLimit, as writes to them count towards
+// node memory and can exhaust it.
+func podUnboundedMemoryEmptyDir(p podContext) (bool, string, bool) {
+	var unbounded []string
+	for _, v := range p.pod.Spec.Volumes {
+		if v.EmptyDir != nil && v.EmptyDir.Medium == corev1.StorageMediumMemory && v.EmptyDir.SizeLimit == nil {
+			unbounded = append(unbounded, v.Name)
+		}
+	}
+	return len(unbounded) == 0, strings.Join(unbounded, ","), true
+}
+
+// Details of the FSGroup check, which are joined when several apply.
+const (
+	fsGroupRoot              = "fsGroup=0"
+	supplementalGroupRoot    = "supplementalGroups=0"
+	fsGroupChangePolicyUnset = "fsGroupChangePolicy=unset"
+)
+
+// podFSGroup checks the pod does not add its processes to the root group with fsGroup or supplementalGroups, as files
+// written to its volumes are then owned by (or accessible to) root. When fsGroup is set, fsGroupChangePolicy should be
+// OnRootMismatch, otherwise the ownership of every file is changed each time a volume is mounted, slowing pod starts
+// on large volumes.
+func podFSGroup(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	if sc == nil {
+		return true, "", true
+	}
+	var problems []string
+	if sc.FSGroup != nil && *sc.FSGroup == 0 {
+		problems = append(problems, fsGroupRoot)
+	}
+	for _, group := range sc.SupplementalGroups {
+		if group == 0 {
+			problems = append(problems, supplementalGroupRoot)
+			break
+		}
+	}
+	if sc.FSGroup != nil && sc.FSGroupChangePolicy == nil {
+		problems = append(problems, fsGroupChangePolicyUnset)
+	}
+	return len(problems) == 0, strings.Join(problems, ","), true
+}
+
+// podZeroTerminationGracePeriod checks the pod does not set terminationGracePeriodSeconds to 0, which kills its containers with
+// SIGKILL without giving them a chance to clean up, e.g. to drain connections.
+func podZeroTerminationGracePeriod(p podContext) (bool, string, bool) {
+	period := p.pod.Spec.TerminationGracePeriodSeconds
+	return period == nil || *period != 0, "", true
+}
+
+// podSeccompProfile checks the pod level seccomp profile. Containers can set their own profile, so the pod level
+// profile is only required when at least one container does not.
+func podSeccompProfile(p podContext) (bool, string, bool) {
+	sc := p.pod.Spec.SecurityContext
+	podConfined := sc != nil && seccompConfined(sc.SeccompProfile)
+	allContainersConfined := len(p.containers) > 0
+	for _, c := range p.containers {
+		if c.container.SecurityContext == nil || !seccompConfined(c.container.SecurityContext.SeccompProfile) {
+			allContainersConfined = false
+		}
+	}
+	return podConfined || allContainersConfined, seccompProfileType(sc), true
+}
+
+// containerSeccompProfile is only reported when the container overrides the pod's profile.
+func containerSeccompProfile(_ podContext, c corev1.Container) (bool, string, bool) {
+	sc := c.SecurityContext
+	if sc == nil || sc.SeccompProfile == nil {
+		return false, "", false
+	}
+	return seccompConfined(sc.SeccompProfile), string(sc.SeccompProfile.Type), true
+}
+
+// podServiceAccountToken checks the token is not mounted. Most workloads behind an ingress don't need API access, so
+// the token is only a liability if they are compromised.
+func podServiceAccountToken(p podContext) (bool, string, bool) {
+	return !automountsServiceAccountToken(p.pod, p.serviceAccount), serviceAccountName(p.pod), true
+}
+
+// containerAllowPrivilegeEscalation checks AllowPrivilegeEscalation is explicitly set to false. The detail distinguishes
+// a container which explicitly allows escalation from one which omits the field, as escalation is allowed by default.
+func containerAllowPrivilegeEscalation(_ podContext, c corev1.Container) (bool, string, bool) {
+	sc := c.SecurityContext
+	if sc == nil || sc.AllowPrivilegeEscalation == nil {
+		return false, allowPrivilegeEscalationUnset, true
+	}
+	if *sc.AllowPrivilegeEscalation {
+		return false, allowPrivilegeEscalationTrue, true
+	}
+	return true, "", true
+}
+
+// Details of a failed AllowPrivilegeEscalation check.
+const (
+	allowPrivilegeEscalationTrue  = "true"
+	allowPrivilegeEscalationUnset = "unset"
+)
+
+// containerResourceLimits checks the container sets CPU and memory limits, so it cannot starve the other pods on the
+// node.
+func containerResourceLimits(_ podContext, c corev1.Container) (bool, string, bool) {
+	var missing []string
+	for _, resource := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if _, ok := c.Resources.Limits[resource]; !ok {
+			missing = append(missing, string(resource))
+		}
+	}
+	return len(missing) == 0, strings.Join(missing, ","), true
+}
+
+// containerMissingProbes checks the container defines a readinessProbe and a livenessProbe, so it is only sent traffic
+// once ready and is restarted if it hangs. Init and ephemeral containers do not support probes, so the check only
+// applies to the pod's regular containers. The detail lists the missing probes.
+func containerMissingProbes(_ podContext, c corev1.Container) (bool, string, bool) {
+	var missing []string
+	if c.ReadinessProbe == nil {
+		missing = append(missing, "readinessProbe")
+	}
+	if c.LivenessProbe == nil {
+		missing = append(missing, "livenessProbe")
+	}
+	return len(missing) == 0, strings.Join(missing, ","), true
+}
+
+func containerReadOnlyRootFilesystem(_ podContext, c corev1.Container) (bool, string, bool) {
+	sc := c.SecurityContext
+	return sc != nil && sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem, "", true
+}
+
+func containerDropAllCapabilities(_ podContext, c corev1.Container) (bool, string, bool) {
+	if c.SecurityContext == nil || c.SecurityContext.Capabilities == nil {
+		return false, "", true
+	}
+	for _, capability := range c.SecurityContext.Capabilities.Drop {
+		if normaliseCapability(capability) == "ALL" {
+			return true, "", true
+		}
+	}
+	return false, "", true
+}
+
+// containerDangerousCapabilities reports the dangerous capabilities which are added back in the detail.
+func containerDangerousCapabilities(p podContext, c corev1.Container) (bool, string, bool) {
+	if c.SecurityContext == nil || c.SecurityContext.Capabilities == nil {
+		return true, "", true
+	}
+	var dangerous []string
+	for _, capability := range c.SecurityContext.Capabilities.Add {
+		name := normaliseCapability(capability)
+		if dangerousCapabilities[name] && !p.compliance.DangerousCapabilities.allowsCapability(name) {
+			dangerous = append(dangerous, string(capability))
+		}
+	}
+	return len(dangerous) == 0, strings.Join(dangerous, ","), true
+}
+
+// containerWritableHostPath checks the container does not mount any hostPath volume read-write. A writable host
+// mount undermines ReadOnlyRootFilesystem, as the container can still write to the node. The offending volume
+// names and mount paths are reported in the detail. Sensitive host paths are reported by the SensitiveHostPath check
+// instead, so each mount is only reported once, except on Windows where that check does not run.
+func containerWritableHostPath(p podContext, c corev1.Container) (bool, string, bool) {
+	mounts := writableHostPathMounts(p.pod, c, func(hostPath string) bool {
+		return p.os == corev1.Windows || !p.compliance.SensitiveHostPathVolume.matches(hostPath)
+	})
+	return len(mounts) == 0, strings.Join(mounts, ","), true
+}
+
+// containerSensitiveHostPath checks the container does not mount a sensitive host path, such as the container
+// runtime socket or the host's root filesystem, read-write.
+func containerSensitiveHostPath(p podContext, c corev1.Container) (bool, string, bool) {
+	mounts := writableHostPathMounts(p.pod, c, p.compliance.SensitiveHostPathVolume.matches)
+	return len(mounts) == 0, strings.Join(mounts, ","), true
+}
+
+// podSensitiveHostPathVolume checks the pod does not have a hostPath volume of a sensitive host path which is mounted
+// read-only or not mounted at all, as the volume can still be mounted by a later change to the pod. Read-write mounts
+// are reported by the SensitiveHostPath check instead. The detail lists each path and how it is mounted, e.g.
+// /etc (read-only).
+func podSensitiveHostPathVolume(p podContext) (bool, string, bool) {
+	var sensitive []string
+	for _, v := range p.pod.Spec.Volumes {
+		if v.HostPath == nil {
+			continue
+		}
+		hostPath := path.Clean(v.HostPath.Path)
+		if !p.compliance.SensitiveHostPathVolume.matches(hostPath) {
+			continue
+		}
+		mode := volumeMountMode(p.containers, v.Name)
+		if mode == "read-write" {
+			continue
+		}
+		sensitive = append(sensitive, fmt.Sprintf("%s (%s)", hostPath, mode))
+	}
+	return len(sensitive) == 0, strings.Join(sensitive, ","), true
+}
+
+// volumeMountMode returns how the pod's containers mount the named volume: read-write if any container mounts it
+// read-write, read-only if every mount is read-only, or not mounted.
+func volumeMountMode(containers []typedContainer, volume string) string {
+	mode := "not mounted"
+	for _, c := range containers {
+		for _, m := range c.container.VolumeMounts {
+			if m.Name != volume {
+				continue
+			}
+			if !m.ReadOnly {
+				return "read-write"
+			}
+			mode = "read-only"
+		}
+	}
+	return mode
+}
+
+// containerProcMount checks the container keeps the default masked /proc, as an unmasked /proc exposes kernel
+// interfaces which are a known container escape vector.
+func containerProcMount(_ podContext, c corev1.Container) (bool, string, bool) {
+	sc := c.SecurityContext
+	unmasked := sc != nil && sc.ProcMount != nil && *sc.ProcMount == corev1.UnmaskedProcMount
+	return !unmasked, "", true
+}
+
+// containerHostPort checks the container does not bind a port on the node, which bypasses the pod's network isolation
+// and limits scheduling to one such pod per node. The host ports are reported in the detail, e.g. 8080/TCP.
+func containerHostPort(_ podContext, c corev1.Container) (bool, string, bool) {
+	var hostPorts []string
+	for _, port := range c.Ports {
+		if port.HostPort == 0 {
+			continue
+		}
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		hostPorts = append(hostPorts, fmt.Sprintf("%d/%s", port.HostPort, protocol))
+	}
+	return len(hostPorts) == 0, strings.Join(hostPorts, ","), true
+}
+
+// writableHostPathMounts returns the container's read-write mounts of hostPath volumes whose host path matches,
+// formatted as volume:mountPath.
+func writableHostPathMounts(pod corev1.Pod, c corev1.Container, match func(hostPath string) bool) []string {
+	hostPaths := make(map[string]string)
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil {
+			hostPaths[v.Name] = path.Clean(v.HostPath.Path)
+		}
+	}
+
+	var mounts []string
+	for _, m := range c.VolumeMounts {
+		hostPath, ok := hostPaths[m.Name]
+		if !ok || m.ReadOnly || !match(hostPath) {
+			continue
+		}
+		mounts = append(mounts, m.Name+":"+m.MountPath)
+	}
+	return mounts
+}
+
+// Types of container within a pod, used to label container level findings.
+const (
+	containerTypeContainer          = "container"
+	containerTypeInitContainer      = "initContainer"
+	containerTypeEphemeralContainer = "ephemeralContainer"
+)
+
+// typedContainer is a container from any of the pod's container lists, along with which list it came from.
+type typedContainer struct {
+	container     corev1.Container
+	containerType string
+}
+
+// podContainers returns all the containers in the pod, including init and ephemeral containers.
+func podContainers(pod corev1.Pod) []typedContainer {
+	var containers []typedContainer
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, typedContainer{container: c, containerType: containerTypeInitContainer})
+	}
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, typedContainer{container: c, containerType: containerTypeContainer})
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, typedContainer{container: corev1.Container(c.EphemeralContainerCommon), containerType: containerTypeEphemeralContainer})
+	}
+	return containers
+}
+
+// serviceAccountName returns the name of the pod's service account, which is "default" when unset.
+func serviceAccountName(pod corev1.Pod) string {
+	if pod.Spec.ServiceAccountName == "" {
+		return "default"
+	}
+	return pod.Spec.ServiceAccountName
+}
+
+// automountsServiceAccountToken returns whether the service account token is mounted into the pod. The pod's
+// setting takes precedence over the service account's, and the token is mounted when neither is set.
+func automountsServiceAccountToken(pod corev1.Pod, serviceAccount *corev1.ServiceAccount) bool {
+	if pod.Spec.AutomountServiceAccountToken != nil {
+		return *pod.Spec.AutomountServiceAccountToken
+	}
+	if serviceAccount != nil && serviceAccount.AutomountServiceAccountToken != nil {
+		return *serviceAccount.AutomountServiceAccountToken
+	}
+	return true
+}
+
+// podOS returns the OS the pod runs on. Windows pods are detected from spec.os, a kubernetes.io/os=windows node
+// selector, or Windows options in the pod or any container's security context. Every other pod is treated as Linux.
+func podOS(pod corev1.Pod) corev1.OSName {
+	if pod.Spec.OS != nil && pod.Spec.OS.Name != "" {
+		return pod.Spec.OS.Name
+	}
+	if pod.Spec.NodeSelector[corev1.LabelOSStable] == string(corev1.Windows) {
+		return corev1.Windows
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.WindowsOptions != nil {
+		return corev1.Windows
+	}
+	for _, c := range podContainers(pod) {
+		if sc := c.container.SecurityContext; sc != nil && sc.WindowsOptions != nil {
+			return corev1.Windows
+		}
+	}
+	return corev1.Linux
+}
+
+// isHostProcess returns whether the Windows options run the pod or container as HostProcess.
+func isHostProcess(options *corev1.WindowsSecurityContextOptions) bool {
+	return options != nil && options.HostProcess != nil && *options.HostProcess
+}
+
+// isRootUser returns whether the RunAsUser is explicitly set to the root user.
+func isRootUser(runAsUser *int64) bool {
+	return runAsUser != nil && *runAsUser == 0
+}
+
+// seccompConfined returns whether the seccomp profile restricts the syscalls available to the container,
+// as required by the PodSecurity restricted profile.
+func seccompConfined(profile *corev1.SeccompProfile) bool {
+	if profile == nil {
+		return false
+	}
+	return profile.Type == corev1.SeccompProfileTypeRuntimeDefault || profile.Type == corev1.SeccompProfileTypeLocalhost
+}
+
+// seccompProfileType returns the type of the pod level seccomp profile, or "unset" if there isn't one.
+func seccompProfileType(podSC *corev1.PodSecurityContext) string {
+	if podSC == nil || podSC.SeccompProfile == nil {
+		return "unset"
+	}
+	return string(podSC.SeccompProfile.Type)
+}
+
+// normaliseCapability converts a capability into the upper case form without the CAP_ prefix, as the container
+// runtimes accept both forms.
+func normaliseCapability(c corev1.Capability) string {
+	return strings.TrimPrefix(strings.ToUpper(string(c)), "CAP_")
+}
+
+// Message returns the human-readable console message for a failed finding.
+func (f Finding) Message() string {
+	var description string
+	switch f.Check {
+	case CheckPrivileged:
+		description = "Container is running as privileged"
+	case CheckWindowsHostProcess:
+		if f.Container == "" {
+			description = "Pod is running as a privileged Windows HostProcess pod"
+		} else {
+			description = "Container is running as a privileged Windows HostProcess container"
+		}
+	case CheckWindowsRunAsUserName:
+		if f.Detail == runAsUserNameUnset {
+			description = "runAsUserName is unset, so the container runs as the image's default user, which is often ContainerAdministrator"
+		} else {
+			description = "runAsUserName is set to an administrator account: " + f.Detail
+		}
+	case CheckRunAsNonRoot:
+		description = "RunAsNonRoot is not set to true"
+	case CheckRunAsUserRoot:
+		description = "RunAsUser is explicitly set to 0 (root)"
+	case CheckRunAsNonRootConflict:
+		description = "RunAsNonRoot is set to true but RunAsUser is 0, so the kubelet will refuse to start the container"
+	case CheckAllowPrivilegeEscalation:
+		if f.Detail == allowPrivilegeEscalationTrue {
+			description = "AllowPrivilegeEscalation is explicitly set to true"
+		} else {
+			description = "AllowPrivilegeEscalation is unset, which defaults to allowing escalation"
+		}
+	case CheckReadOnlyRootFilesystem:
+		description = "ReadOnlyRootFilesystem is not enabled for service"
+	case CheckDropAllCapabilities:
+		description = "Capabilities do not drop ALL"
+	case CheckWritableHostPath:
+		description = "Container mounts hostPath volumes read-write: " + f.Detail
+	case CheckSensitiveHostPath:
+		description = "Container mounts sensitive host paths read-write: " + f.Detail
+	case CheckSensitiveHostPathVolume:
+		description = "Pod has hostPath volumes of sensitive host paths: " + f.Detail
+	case CheckProcMount:
+		description = "procMount is set to Unmasked"
+	case CheckHostPort:
+		description = "hostPort is bound: " + f.Detail
+	case CheckDangerousCapabilities:
+		description = "Dangerous capabilities added: " + f.Detail
+	case CheckHostNetwork:
+		description = "HostNetwork is enabled"
+	case CheckHostPID:
+		description = "HostPID is enabled"
+	case CheckHostIPC:
+		description = "HostIPC is enabled"
+	case CheckUnsafeSysctls:
+		description = "Unsafe sysctls are set: " + f.Detail
+	case CheckSeccompProfile:
+		if f.Container == "" {
+			description = "SeccompProfile is not set to RuntimeDefault or Localhost, got " + f.Detail
+		} else {
+			description = "SeccompProfile is overridden with " + f.Detail
+		}
+	case CheckServiceAccountToken:
+		description = "Service account token is automatically mounted for service account " + f.Detail
+	case CheckResourceLimits:
+		description = "Resource limits are not set: " + f.Detail
+	case CheckLatestImageTag:
+		switch f.Detail {
+		case imageUntagged:
+			description = "Image has no tag, so defaults to the mutable latest tag"
+		case imageInvalid:
+			description = "Image is not a valid image reference"
+		default:
+			description = "Image uses the mutable latest tag"
+		}
+	case CheckFSGroup:
+		description = "Pod groups are misconfigured: " + f.Detail
+		if strings.Contains(f.Detail, fsGroupChangePolicyUnset) {
+			description += "; set fsGroupChangePolicy to OnRootMismatch to avoid changing the ownership of every file on each mount"
+		}
+	case CheckMissingProbes:
+		description = "Probes are not defined: " + f.Detail
+	case CheckZeroTerminationGracePeriod:
+		description = "terminationGracePeriodSeconds is 0, so containers are killed without a chance to clean up"
+	case CheckUnboundedMemoryEmptyDir:
+		description = "Memory backed emptyDir volumes have no sizeLimit: " + f.Detail
+	case CheckBackendServiceNotFound:
+		description = "Backend service not found"
+	default:
+		description = f.Check + " check failed"
+		if f.Detail != "" {
+			description += ", got " + f.Detail
+		}
+	}
+
+	return fmt.Sprintf("%s: %s (%s)", f.Subject(), description, findingLocation(f))
+}
+
+// PassMessage returns the human-readable console message for a passed finding, naming the check which passed.
+func (f Finding) PassMessage() string {
+	return fmt.Sprintf("%s: %s passed (%s)", f.Subject(), f.Check, findingLocation(f))
+}
+
+// findingLocation returns where the finding was found, for use in console messages.
+func findingLocation(f Finding) string {
+	location := "pod: " + f.Pod
+	if f.OwnerKind != "" && f.OwnerKind != "Pod" {
+		location += ", owner: " + f.OwnerKind + "/" + f.Owner
+	}
+	if f.Check == CheckBackendServiceNotFound {
+		return "ingress: " + f.Ingress + ", namespace: " + f.Namespace
+	}
+	if f.Pod == "" {
+		location = "workload: " + f.Workload
+	}
+	if f.Container != "" {
+		containerType := f.ContainerType
+		if containerType == "" {
+			containerType = containerTypeContainer
+		}
+		location += ", " + containerType + ": " + f.Container
+	}
+	switch f.Check {
+	case CheckHostNetwork, CheckHostPID, CheckHostIPC:
+		location += ", namespace: " + f.Namespace
+	}
+	if f.Image != "" {
+		location += ", image: " + f.Image
+	}
+	switch f.Type {
+	case TypeIngress, TypeHTTPRoute:
+		location += ", via " + f.Type
+		// The route is not known when checking a service's pod templates from manifests
+		if f.Ingress != "" {
+			location += ": " + f.Ingress
+		}
+	case TypeLoadBalancer, TypeClusterIP:
+		location += ", via " + f.Type
+	}
+	if f.TotalPods > 1 {
+		location += ", affected pods: " + f.AffectedReplicas()
+	}
+	if len(f.SharedWith) > 0 {
+		location += ", also behind: " + strings.Join(f.SharedWith, ",")
+	}
+	if f.ApprovedImage != nil && !*f.ApprovedImage {
+		location += ", unapproved image"
+	}
+	if f.NamespaceOwner != "" {
+		location += ", namespace owner: " + f.NamespaceOwner
+	}
+	if f.Cluster != "" {
+		location += ", cluster: " + f.Cluster
+	}
+	return location
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// failedChecks returns the names of the default checks which fail for the pod, sorted.
+func failedChecks(pod corev1.Pod) []string {
+	var failed []string
+	for _, f := range checkPod(Result{Namespace: testNamespace}, pod, nil, enabledChecks(DefaultChecks(), nil), Compliance{}) {
+		if !f.Passed {
+			failed = append(failed, f.Check)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// hostPathPod returns a pod with a container which mounts the host path.
+func hostPathPod(hostPath string, readOnly bool) corev1.Pod {
+	pod := *newPod("web-1", "web", corev1.PodRunning)
+	pod.Spec.Volumes = []corev1.Volume{{Name: "host", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: hostPath}}}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "host", MountPath: "/host", ReadOnly: readOnly}}
+	return pod
+}
+
+func TestHostPathChecks(t *testing.T) {
+	tests := []struct {
+		hostPath string
+		readOnly bool
+		want     string // The host path check which fails, if any
+	}{
+		{hostPath: "/var/run", readOnly: true, want: CheckSensitiveHostPathVolume},
+		{hostPath: "/run/containerd/containerd.sock", readOnly: true, want: CheckSensitiveHostPathVolume},
+		{hostPath: "/var/run/docker.sock", readOnly: false, want: CheckSensitiveHostPath},
+		{hostPath: "/var/lib/kubelet/pods", readOnly: false, want: CheckSensitiveHostPath},
+		{hostPath: "/data", readOnly: false, want: CheckWritableHostPath},
+		{hostPath: "/data", readOnly: true},
+		{hostPath: "/var/log", readOnly: true},
+	}
+	hostPathChecks := map[string]bool{CheckWritableHostPath: true, CheckSensitiveHostPath: true, CheckSensitiveHostPathVolume: true}
+
+	for _, tt := range tests {
+		var got []string
+		for _, check := range failedChecks(hostPathPod(tt.hostPath, tt.readOnly)) {
+			if hostPathChecks[check] {
+				got = append(got, check)
+			}
+		}
+		if tt.want == "" && len(got) != 0 || tt.want != "" && (len(got) != 1 || got[0] != tt.want) {
+			t.Errorf("host path %s (read-only %t) failed %v, want only %q", tt.hostPath, tt.readOnly, got, tt.want)
+		}
+	}
+}
+
+func TestContainerAllowPrivilegeEscalation(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name       string
+		sc         *corev1.SecurityContext
+		wantPassed bool
+		wantDetail string
+	}{
+		{name: "no security context", wantDetail: allowPrivilegeEscalationUnset},
+		{name: "nil", sc: &corev1.SecurityContext{}, wantDetail: allowPrivilegeEscalationUnset},
+		{name: "true", sc: &corev1.SecurityContext{AllowPrivilegeEscalation: &enabled}, wantDetail: allowPrivilegeEscalationTrue},
+		{name: "false", sc: &corev1.SecurityContext{AllowPrivilegeEscalation: &disabled}, wantPassed: true},
+	}
+	for _, tt := range tests {
+		passed, detail, applies := containerAllowPrivilegeEscalation(podContext{}, corev1.Container{Name: "app", SecurityContext: tt.sc})
+		if passed != tt.wantPassed || detail != tt.wantDetail || !applies {
+			t.Errorf("%s: containerAllowPrivilegeEscalation() = %t, %q, %t, want %t, %q, true", tt.name, passed, detail, applies, tt.wantPassed, tt.wantDetail)
+		}
+	}
+}
+
+func TestMissingProbesContainerTypes(t *testing.T) {
+	pod := *newPod("web-1", "web", corev1.PodRunning)
+	// An init container of the same name as a regular container must not be mistaken for it
+	pod.Spec.InitContainers = []corev1.Container{{Name: "migrate"}, {Name: "app"}}
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug"}}}
+
+	findings := checkPod(Result{Namespace: testNamespace}, pod, nil, enabledChecks(CheckSet{CheckMissingProbes: true}, nil), Compliance{})
+	if len(findings) != 1 {
+		t.Fatalf("checkPod() findings = %+v, want one for the regular container", findings)
+	}
+	if f := findings[0]; f.ContainerType != containerTypeContainer || f.Passed || f.Detail != "readinessProbe,livenessProbe" {
+		t.Errorf("checkPod() finding = %+v, want a failure of the regular container missing both probes", f)
+	}
+}
@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// findingCollector aggregates the outcome of each service checked by Check's workers, and builds the report once they
+// have finished. It is safe for concurrent use. Findings are passed to opts.OnFinding as they are added, and the
+// progress to opts.OnProgress.
+type findingCollector struct {
+	opts     Options
+	total    int                // Number of services queued, for opts.OnProgress
+	cancel   context.CancelFunc // Cancels the remaining work on the first error
+	stopFeed chan struct{}      // Closed once opts.MaxFindings failures have been found
+
+	mu       sync.Mutex
+	checked  []serviceFindings
+	firstErr error
+	skipped  map[string]bool // Namespaces skipped as access is forbidden
+	failures int
+	progress int             // Number of services checked
+	streamed map[string]bool // The duplicateKey of each finding passed to opts.OnFinding
+}
+
+// newFindingCollector returns a collector for the total number of services queued. cancel is called on the first
+// error which is not skipped.
+func newFindingCollector(opts Options, total int, cancel context.CancelFunc) *findingCollector {
+	return &findingCollector{
+		opts:     opts,
+		total:    total,
+		cancel:   cancel,
+		stopFeed: make(chan struct{}),
+		skipped:  make(map[string]bool),
+		streamed: make(map[string]bool),
+	}
+}
+
+// add records the findings from checking a service, or the error from doing so. When opts.SkipForbidden is set,
+// forbidden errors skip the service's namespace rather than failing the scan.
+func (c *findingCollector) add(namespace string, sf serviceFindings, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case err != nil && c.opts.SkipForbidden && k8sErrors.IsForbidden(err):
+		if !c.skipped[namespace] {
+			slog.Warn("Access forbidden, skipping namespace", "namespace", namespace, "err", err)
+		}
+		c.skipped[namespace] = true
+	case err != nil:
+		if c.firstErr == nil {
+			c.firstErr = err
+			c.cancel()
+		}
+	default:
+		sf.findings = reportedFindings(sf.findings, c.opts)
+		c.checked = append(c.checked, sf)
+		c.stream(sf.findings)
+	}
+
+	c.progress++
+	if c.opts.OnProgress != nil {
+		c.opts.OnProgress(c.progress, c.total)
+	}
+}
+
+// stream passes the findings to opts.OnFinding, skipping those already streamed for another service, and stops the
+// scan once opts.MaxFindings failures have been found. The caller must hold c.mu.
+func (c *findingCollector) stream(findings []Finding) {
+	maxFindings := c.opts.MaxFindings
+	for _, f := range findings {
+		if maxFindings > 0 && c.failures >= maxFindings {
+			break
+		}
+		if key := duplicateKey(f); key != "" {
+			if c.streamed[key] {
+				continue
+			}
+			c.streamed[key] = true
+		}
+		if f.Failed() {
+			c.failures++
+		}
+		if c.opts.OnFinding != nil {
+			c.opts.OnFinding(f)
+		}
+	}
+	if maxFindings > 0 && c.failures >= maxFindings && !truncated(c.stopFeed) {
+		slog.Warn("Reached the maximum number of findings, stopping the scan", "maxFindings", maxFindings)
+		close(c.stopFeed)
+	}
+}
+
+// report returns the findings grouped by the given namespaces, in the order the services were queued, once every
+// worker has finished. Namespaces where access was forbidden are left out. The 2nd return value is whether the report
+// was truncated by opts.MaxFindings, i.e. failures were left out or services were not checked, rather than there being
+// exactly MaxFindings failures.
+func (c *findingCollector) report(namespaces []string) ([]NamespaceFindings, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	opts := c.opts
+
+	sort.Slice(c.checked, func(a, b int) bool { return c.checked[a].index < c.checked[b].index })
+
+	report := make([]NamespaceFindings, 0, len(namespaces))
+	byNamespace := make(map[string]int, len(namespaces))
+	for _, namespace := range namespaces {
+		if c.skipped[namespace] {
+			continue
+		}
+		byNamespace[namespace] = len(report)
+		report = append(report, NamespaceFindings{Namespace: namespace, Cluster: opts.Cluster, Findings: []Finding{}})
+	}
+
+	// Truncate to the first MaxFindings failures, in the order the services were queued, so the output is the same
+	// between runs
+	remaining := opts.MaxFindings
+	seen := make(map[string]int)      // Index of each finding by its duplicateKey
+	cut := c.progress < c.total       // The scan stopped before every service was checked
+	dropped := func(f Finding) bool { // Whether leaving out the finding truncates the report
+		_, duplicate := seen[duplicateKey(f)]
+		return f.Failed() && !duplicate
+	}
+	for _, sf := range c.checked {
+		i := sf.result
+		// Any services which were checked before access was forbidden only give a partial view of the namespace
+		if c.skipped[i.Namespace] {
+			continue
+		}
+		if opts.MaxFindings > 0 && remaining <= 0 {
+			for _, f := range sf.findings {
+				cut = cut || dropped(f)
+			}
+			continue
+		}
+		if sf.noSelector {
+			slog.Info("Service has no selector, endpoints managed externally, skipping", "ingress", i.Name, "service", i.BackendService, "namespace", i.Namespace)
+			continue
+		}
+		if sf.noPods && sf.tooNew > 0 {
+			slog.Info("All active pods are too new to evaluate, skipping", "ingress", i.Name, "service", i.BackendService, "namespace", i.Namespace, "tooNewPods", sf.tooNew)
+			continue
+		}
+		if sf.noPods {
+			slog.Info("No active pods found, skipping", "ingress", i.Name, "service", i.BackendService, "namespace", i.Namespace, "inactivePods", sf.inactive)
+			continue
+		}
+
+		nsFindings := &report[byNamespace[i.Namespace]]
+		for _, f := range sf.findings {
+			if opts.MaxFindings > 0 && remaining <= 0 {
+				cut = cut || dropped(f)
+				continue
+			}
+			if key := duplicateKey(f); key != "" {
+				if j, ok := seen[key]; ok {
+					nsFindings.Findings[j].addSharedWith(f.Service)
+					continue
+				}
+				seen[key] = len(nsFindings.Findings)
+			}
+			nsFindings.Findings = append(nsFindings.Findings, f)
+			if opts.MaxFindings > 0 && f.Failed() {
+				remaining--
+			}
+		}
+	}
+
+	// The failures after the truncation point are unknown rather than resolved
+	if !cut {
+		opts.Baseline.addResolved(report)
+	}
+	opts.Exceptions.logApplied(report)
+
+	if len(c.skipped) > 0 {
+		skippedNamespaces := make([]string, 0, len(c.skipped))
+		for namespace := range c.skipped {
+			skippedNamespaces = append(skippedNamespaces, namespace)
+		}
+		sort.Strings(skippedNamespaces)
+		slog.Warn("Skipped namespaces where access is forbidden", "count", len(skippedNamespaces), "namespaces", strings.Join(skippedNamespaces, ","))
+	}
+
+	return report, cut
+}
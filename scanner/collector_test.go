@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestReportSharedWith(t *testing.T) {
+	clientset := newClientset(
+		newIngress("web", httpRule(serviceBackend("web"), serviceBackend("web-canary"), serviceBackend("api"))),
+		newService("web", "web"),
+		newService("web-canary", "web"),
+		newService("api", "api"),
+		newPod("web-1", "web", corev1.PodRunning),
+		newPod("api-1", "api", corev1.PodRunning),
+	)
+
+	report, err := Scan(context.Background(), clientset, Options{Namespace: testNamespace, Checks: CheckSet{CheckRunAsNonRoot: true}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	findings := report[0].Findings
+	if len(findings) != 2 {
+		t.Fatalf("Scan() findings = %+v, want one for each pod", findings)
+	}
+	for _, f := range findings {
+		switch f.Pod {
+		case "web-1":
+			// The services are queued by name, so the pod's findings are reported against the first of them
+			if f.Service != "web" || len(f.SharedWith) != 1 || f.SharedWith[0] != "web-canary" {
+				t.Errorf("web-1 finding service = %s, sharedWith = %v, want web shared with [web-canary]", f.Service, f.SharedWith)
+			}
+		case "api-1":
+			if f.Service != "api" || len(f.SharedWith) != 0 {
+				t.Errorf("api-1 finding service = %s, sharedWith = %v, want api shared with none", f.Service, f.SharedWith)
+			}
+		default:
+			t.Errorf("unexpected finding for pod %q", f.Pod)
+		}
+	}
+}
+
+func TestReportTruncated(t *testing.T) {
+	tests := []struct {
+		maxFindings   int
+		wantFindings  int
+		wantTruncated bool
+	}{
+		{maxFindings: 0, wantFindings: 2},
+		{maxFindings: 2, wantFindings: 2},
+		{maxFindings: 1, wantFindings: 1, wantTruncated: true},
+	}
+	for _, tt := range tests {
+		clientset := newClientset(
+			newIngress("web", httpRule(serviceBackend("api"), serviceBackend("web"))),
+			newService("api", "api"),
+			newService("web", "web"),
+			newPod("api-1", "api", corev1.PodRunning),
+			newPod("web-1", "web", corev1.PodRunning),
+		)
+		truncated := false
+		opts := Options{
+			Namespace:   testNamespace,
+			Checks:      CheckSet{CheckRunAsNonRoot: true},
+			MaxFindings: tt.maxFindings,
+			Concurrency: 1,
+			OnTruncated: func() { truncated = true },
+		}
+
+		report, err := Scan(context.Background(), clientset, opts)
+		if err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		if got := Failures(report); got != tt.wantFindings || truncated != tt.wantTruncated {
+			t.Errorf("Scan() with MaxFindings %d = %d failures, truncated %t, want %d, %t", tt.maxFindings, got, truncated, tt.wantFindings, tt.wantTruncated)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Compliance configures what counts as passing for the checks where teams have slightly different baselines.
+// The zero value is strict.
+type Compliance struct {
+	RunAsNonRoot            RunAsNonRootCompliance            `json:"runAsNonRoot,omitempty"`
+	DangerousCapabilities   DangerousCapabilitiesCompliance   `json:"dangerousCapabilities,omitempty"`
+	UnsafeSysctls           UnsafeSysctlsCompliance           `json:"unsafeSysctls,omitempty"`
+	SensitiveHostPathVolume SensitiveHostPathVolumeCompliance `json:"sensitiveHostPathVolume,omitempty"`
+}
+
+// RunAsNonRootCompliance configures the RunAsNonRoot check.
+type RunAsNonRootCompliance struct {
+	// MinRunAsUser treats a pod as running as non-root when RunAsUser is at least this value in the pod security
+	// context (or every container), even if RunAsNonRoot is unset. 0 to always require RunAsNonRoot
+	MinRunAsUser int64 `json:"minRunAsUser,omitempty"`
+}
+
+// DangerousCapabilitiesCompliance configures the DangerousCapabilities check.
+type DangerousCapabilitiesCompliance struct {
+	// Allowed are the dangerous capabilities which may be added, e.g. NET_ADMIN for a CNI plugin
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// UnsafeSysctlsCompliance configures the UnsafeSysctls check.
+type UnsafeSysctlsCompliance struct {
+	// Allowed are the unsafe sysctls which may be set, e.g. those enabled with the kubelet's --allowed-unsafe-sysctls.
+	// As with the kubelet, a trailing * matches every sysctl with that prefix, e.g. net.core.*
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// SensitiveHostPathVolumeCompliance configures the sensitive host paths of the SensitiveHostPathVolume and
+// SensitiveHostPath checks.
+type SensitiveHostPathVolumeCompliance struct {
+	// Paths replaces the default list of sensitive host paths. Each path also matches everything beneath it, except /
+	// which only matches itself. Empty for the default list
+	Paths []string `json:"paths,omitempty"`
+}
+
+// LoadConfig reads and validates the YAML compliance config file at path.
+func LoadConfig(path string) (Compliance, error) {
+	var config Compliance
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error whilst reading config file: %w", err)
+	}
+	if err := unmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("error whilst parsing config file %s: %w", path, err)
+	}
+	if config.RunAsNonRoot.MinRunAsUser < 0 {
+		return config, fmt.Errorf("runAsNonRoot.minRunAsUser in %s must not be negative, got %d", path, config.RunAsNonRoot.MinRunAsUser)
+	}
+	for _, capability := range config.DangerousCapabilities.Allowed {
+		if !dangerousCapabilities[normaliseCapability(corev1.Capability(capability))] {
+			return config, fmt.Errorf("dangerousCapabilities.allowed in %s references %q, which is not a dangerous capability", path, capability)
+		}
+	}
+	for _, sysctl := range config.UnsafeSysctls.Allowed {
+		if sysctl == "" || strings.Contains(strings.TrimSuffix(sysctl, "*"), "*") {
+			return config, fmt.Errorf("unsafeSysctls.allowed in %s references %q, which must be a sysctl name, optionally ending with *", path, sysctl)
+		}
+	}
+	for _, hostPath := range config.SensitiveHostPathVolume.Paths {
+		if !strings.HasPrefix(hostPath, "/") {
+			return config, fmt.Errorf("sensitiveHostPathVolume.paths in %s references %q, which must be an absolute path", path, hostPath)
+		}
+	}
+	slog.Debug("Loaded config", "path", path)
+	return config, nil
+}
+
+// allowsCapability returns whether the dangerous capability has been allowed.
+func (c DangerousCapabilitiesCompliance) allowsCapability(capability string) bool {
+	for _, allowed := range c.Allowed {
+		if normaliseCapability(corev1.Capability(allowed)) == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsSysctl returns whether the unsafe sysctl has been allowed, either by name or by a prefix ending with *.
+func (c UnsafeSysctlsCompliance) allowsSysctl(name string) bool {
+	for _, allowed := range c.Allowed {
+		allowed = normaliseSysctl(allowed)
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns whether the cleaned host path is, or is beneath, one of the sensitive host paths.
+func (c SensitiveHostPathVolumeCompliance) matches(hostPath string) bool {
+	paths := c.Paths
+	if len(paths) == 0 {
+		paths = sensitiveHostPaths
+	}
+	for _, sensitive := range paths {
+		sensitive = path.Clean(sensitive)
+		if hostPath == sensitive || (sensitive != "/" && strings.HasPrefix(hostPath, sensitive+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshalStrict unmarshals the YAML config file into v, rejecting unknown fields so a misspelled key fails loudly
+// rather than silently doing nothing. Unknown fields are reported by their path, e.g. exceptions[1].namspace, along
+// with the fields which are valid there.
+func unmarshalStrict(data []byte, v interface{}) error {
+	err := yaml.UnmarshalStrict(data, v)
+	if err == nil {
+		return nil
+	}
+	var raw interface{}
+	if yaml.Unmarshal(data, &raw) != nil {
+		return err
+	}
+	if unknown := unknownField(raw, reflect.TypeOf(v), ""); unknown != nil {
+		return unknown
+	}
+	return err
+}
+
+// unknownField returns an error for the first field in the decoded YAML value which is not a field of t, or nil if
+// they all are. path is the location of value in the file.
+func unknownField(value interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		known := make(map[string]reflect.Type, t.NumField())
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" || name == "" {
+				continue
+			}
+			known[name] = field.Type
+			names = append(names, name)
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			fieldType, ok := known[key]
+			if !ok {
+				return fmt.Errorf("unknown field %q, must be one of: %s", fieldPath, strings.Join(names, ", "))
+			}
+			if err := unknownField(fields[key], fieldType, fieldPath); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := unknownField(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
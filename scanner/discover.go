@@ -0,0 +1,329 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How a service (or workload) was discovered, which is reported as the type of each finding.
+const (
+	TypeIngress      = "ingress"      // Routed to by an ingress rule
+	TypeHTTPRoute    = "httproute"    // Routed to by a Gateway API HTTPRoute
+	TypeLoadBalancer = "loadbalancer" // A LoadBalancer service, which may expose TCP or UDP rather than HTTP
+	TypeClusterIP    = "clusterip"    // A ClusterIP service, checked with IncludeClusterIP
+	TypeWorkload     = "workload"     // A workload controller's pod template, checked with AllWorkloads
+	TypeService      = "service"      // A service named directly with Service, skipping discovery
+)
+
+// Result stores information about a single service which provides an ingress (ingress or load balancer) into the k8s environment.
+type Result struct {
+	Type             string            // How the service was discovered, e.g. TypeIngress
+	Name             string            // Ingress or route name for route based services, service name for load balancer based routes
+	Namespace        string            // Which namespace does the service belong in
+	BackendService   string            // The backend k8s service which we are routing to
+	ServiceSelectors map[string]string // The pod selectors used for the backend service
+
+	// Set when checking the pod template of a workload controller directly, rather than the pods behind a service
+	WorkloadKind string                  // e.g. Deployment, StatefulSet, DaemonSet, CronJob or Job
+	Template     *corev1.PodTemplateSpec // The workload's pod template
+
+	Missing bool // The backend service does not exist, so a finding is reported instead of checking pods
+}
+
+// ingressName returns the name of the ingress route, which is empty for workload controllers.
+func (r Result) ingressName() string {
+	if r.Template != nil {
+		return ""
+	}
+	return r.Name
+}
+
+// ingressClassAnnotation is the deprecated annotation used to set the ingress class before spec.ingressClassName.
+const ingressClassAnnotation = "kubernetes.io/ingress.class"
+
+// ingressClass returns the class of the ingress from spec.ingressClassName, falling back to the deprecated annotation.
+// Empty when the ingress does not set a class.
+func ingressClass(i networkingv1.Ingress) string {
+	if i.Spec.IngressClassName != nil {
+		return *i.Spec.IngressClassName
+	}
+	return i.Annotations[ingressClassAnnotation]
+}
+
+// filterIngressClass returns the ingresses of the given class, or all ingresses when class is empty.
+func filterIngressClass(ingresses []networkingv1.Ingress, class string) []networkingv1.Ingress {
+	if class == "" {
+		return ingresses
+	}
+	var filtered []networkingv1.Ingress
+	for _, i := range ingresses {
+		if ingressClass(i) == class {
+			filtered = append(filtered, i)
+		}
+	}
+	slog.Info("Found ingress resources of class", "count", len(filtered), "class", class)
+	return filtered
+}
+
+// processService queries for the k8s service and returns a result struct for further processing.
+// The 2nd return value is whether this resource should be skipped. When skipped because the service does not exist,
+// the returned result has Missing set.
+func processService(ctx context.Context, clientset kubernetes.Interface, resultType, namespace, ingressName, backendServiceName string) (Result, bool, error) {
+	var r Result
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, backendServiceName, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		r = Result{
+			Type:           resultType,
+			Name:           ingressName,
+			Namespace:      namespace,
+			BackendService: backendServiceName,
+			Missing:        true,
+		}
+		return r, true, nil
+	}
+	if err != nil {
+		return r, false, fmt.Errorf("error whilst getting service: %w", err)
+	}
+
+	r, skip := serviceResult(*service, resultType, ingressName)
+	return r, skip, nil
+}
+
+// serviceResult returns a result for checking the pods behind the service, which was discovered as resultType via
+// the named ingress or route (or the service itself for load balancer and ClusterIP services). The 2nd return value
+// is whether the service should be skipped as it does not contain any pods.
+func serviceResult(service corev1.Service, resultType, ingressName string) (Result, bool) {
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		return Result{}, true
+	}
+	return Result{
+		Type:             resultType,
+		Name:             ingressName,
+		Namespace:        service.Namespace,
+		BackendService:   service.Name,
+		ServiceSelectors: service.Spec.Selector,
+	}, false
+}
+
+// addListedService adds a service which has already been listed to the results map, unless it has already been
+// discovered, e.g. as the backend of an ingress. added holds the namespace/name of each service already discovered.
+func addListedService(results map[string][]Result, added map[string]bool, service corev1.Service, resultType string) {
+	key := service.Namespace + "/" + service.Name
+	if added[key] {
+		return
+	}
+	added[key] = true
+	if r, skip := serviceResult(service, resultType, service.Name); !skip {
+		results[service.Namespace] = append(results[service.Namespace], r)
+	}
+}
+
+// addBackendService processes a service which is routed to by an ingress (or route) and adds it to the results map,
+// unless it has already been added or should be skipped. When warnMissing is set, services which do not exist are
+// added so that they are reported as a finding, rather than silently skipped. added holds the namespace/name of each
+// service already discovered, including those which were skipped, so each service is only fetched once however many
+// ingress paths route to it.
+func addBackendService(ctx context.Context, clientset kubernetes.Interface, results map[string][]Result, added map[string]bool, resultType, namespace, ingressName, serviceName string, warnMissing bool) error {
+	key := namespace + "/" + serviceName
+	if added[key] {
+		return nil
+	}
+	added[key] = true
+
+	r, skip, err := processService(ctx, clientset, resultType, namespace, ingressName, serviceName)
+	if err != nil {
+		return err
+	}
+	if skip && !(warnMissing && r.Missing) {
+		return nil
+	}
+	results[namespace] = append(results[namespace], r)
+
+	return nil
+}
+
+// discoverService returns the named service in namespace as the only result, for checking a single service without
+// discovering the ingress routes. It is an error if the service does not exist or has no selector, as there would be
+// no pods to check.
+func discoverService(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (map[string][]Result, error) {
+	service, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("service %q does not exist in namespace %q", name, namespace)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error whilst getting service: %w", err)
+	}
+
+	r, skip := serviceResult(*service, TypeService, service.Name)
+	if skip || len(r.ServiceSelectors) == 0 {
+		return nil, fmt.Errorf("service %q in namespace %q has no selector, so there are no pods to check", name, namespace)
+	}
+	slog.Info("Checking a single service", "service", name, "namespace", namespace)
+	return map[string][]Result{namespace: {r}}, nil
+}
+
+// discoverNamespace adds the services which have an ingress route in opts.Namespace (or all namespaces when empty),
+// plus any workloads and ClusterIP services enabled in opts, to the results map. Services which have already been
+// added, e.g. via an ingress in another namespace, are skipped. added holds the namespace/name of each service which
+// has already been discovered.
+func discoverNamespace(ctx context.Context, clientset kubernetes.Interface, results map[string][]Result, added map[string]bool, opts Options) error {
+	ingresses, err := listAll(opts.PageSize, metav1.ListOptions{LabelSelector: opts.IngressSelector}, func(o metav1.ListOptions) ([]networkingv1.Ingress, string, error) {
+		list, err := clientset.NetworkingV1().Ingresses(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing ingresses: %w", err)
+	}
+	if opts.IngressSelector != "" {
+		slog.Info("Found ingress resources matching selector", "count", len(ingresses), "selector", opts.IngressSelector)
+	} else {
+		slog.Info("Found ingress resources", "count", len(ingresses))
+	}
+	ingresses = filterIngressClass(ingresses, opts.IngressClass)
+
+	// Check for services which have at least 1 ingress route
+	for _, i := range ingresses {
+
+		// Using a default backend. Resource backends (rather than services) are skipped
+		if i.Spec.DefaultBackend != nil && i.Spec.DefaultBackend.Service != nil {
+			slog.Debug("Default backend defined", "ingress", i.Name, "namespace", i.Namespace, "service", i.Spec.DefaultBackend.Service.Name)
+
+			if err := addBackendService(ctx, clientset, results, added, TypeIngress, i.Namespace, i.Name, i.Spec.DefaultBackend.Service.Name, opts.WarnMissingBackends); err != nil {
+				return err
+			}
+		}
+
+		// Using HTTP host paths
+		for _, h := range i.Spec.Rules {
+			// Host only rules do not have any HTTP paths
+			if h.HTTP == nil {
+				continue
+			}
+			for _, p := range h.HTTP.Paths {
+				// Resource backends do not route to any pods
+				if p.Backend.Service == nil {
+					continue
+				}
+
+				if err := addBackendService(ctx, clientset, results, added, TypeIngress, i.Namespace, i.Name, p.Backend.Service.Name, opts.WarnMissingBackends); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Check for services which have at least 1 Gateway API route
+	if opts.GatewayClientset != nil {
+		if err := processHTTPRoutes(ctx, clientset, opts.GatewayClientset, results, added, opts); err != nil {
+			return err
+		}
+	}
+
+	// Check all workload controllers, regardless of whether they are reachable via an ingress route
+	if opts.AllWorkloads {
+		if err := processWorkloads(ctx, clientset, results, opts); err != nil {
+			return err
+		}
+	}
+
+	// Check for services which have a LoadBalancer ingress
+	loadBalancerServices, err := listAll(opts.PageSize, metav1.ListOptions{LabelSelector: opts.ServiceSelector}, func(o metav1.ListOptions) ([]corev1.Service, string, error) {
+		list, err := clientset.CoreV1().Services(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing services: %w", err)
+	}
+	if opts.ServiceSelector != "" {
+		slog.Info("Found services matching selector", "count", len(loadBalancerServices), "selector", opts.ServiceSelector)
+	}
+	for _, svc := range loadBalancerServices {
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			addListedService(results, added, svc, TypeLoadBalancer)
+		}
+	}
+
+	// Check ClusterIP services which may be exposed by other means, such as a service mesh
+	if opts.IncludeClusterIP {
+		for _, svc := range loadBalancerServices {
+			if svc.Spec.Type == corev1.ServiceTypeClusterIP || svc.Spec.Type == "" {
+				addListedService(results, added, svc, TypeClusterIP)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Discover returns the services which have an ingress route (an ingress rule, Gateway API HTTPRoute or load balancer
+// service), plus any workloads and ClusterIP services enabled in opts, deduplicated and keyed by namespace.
+// When opts.Namespace is set, it is always present in the returned map, even if no services are found. When
+// opts.Service is also set, only that service is returned. When opts.Namespaces is set, each namespace is discovered in
+// turn, and those which do not exist are logged and skipped.
+func Discover(ctx context.Context, clientset kubernetes.Interface, opts Options) (map[string][]Result, error) {
+	if opts.Namespace != "" {
+		_, err := clientset.CoreV1().Namespaces().Get(ctx, opts.Namespace, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("namespace %q does not exist", opts.Namespace)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error whilst getting namespace: %w", err)
+		}
+	}
+	if opts.Service != "" {
+		if opts.Namespace == "" {
+			return nil, fmt.Errorf("a namespace must be set to check a single service")
+		}
+		return discoverService(ctx, clientset, opts.Namespace, opts.Service)
+	}
+
+	// stores the deduplicated services as a slice, keyed by namespace
+	results := make(map[string][]Result)
+	added := make(map[string]bool) // namespace/service, so each service is only checked once
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{opts.Namespace}
+	}
+	for _, namespace := range namespaces {
+		if len(opts.Namespaces) > 0 {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			if k8sErrors.IsNotFound(err) {
+				slog.Warn("Namespace does not exist, skipping", "namespace", namespace)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error whilst getting namespace: %w", err)
+			}
+		}
+		if namespace != "" {
+			// Ensure the namespace is reported even if no services are found
+			results[namespace] = nil
+		}
+		nsOpts := opts
+		nsOpts.Namespace, nsOpts.Namespaces = namespace, nil
+		if err := discoverNamespace(ctx, clientset, results, added, nsOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	totalResults := 0
+	for _, v := range results {
+		totalResults += len(v)
+	}
+	slog.Info("Services to check (after filtering)", "count", totalResults)
+
+	return results, nil
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testNamespace is the namespace the test objects are created in.
+const testNamespace = "payments"
+
+// newClientset returns a fake clientset containing the test namespace and the given objects.
+func newClientset(objects ...runtime.Object) *fake.Clientset {
+	objects = append([]runtime.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}}, objects...)
+	return fake.NewSimpleClientset(objects...)
+}
+
+// newIngress returns an ingress in the test namespace with the given rules.
+func newIngress(name string, rules ...networkingv1.IngressRule) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       networkingv1.IngressSpec{Rules: rules},
+	}
+}
+
+// httpRule returns an ingress rule with a path for each of the backends.
+func httpRule(backends ...networkingv1.IngressBackend) networkingv1.IngressRule {
+	var paths []networkingv1.HTTPIngressPath
+	for _, b := range backends {
+		paths = append(paths, networkingv1.HTTPIngressPath{Backend: b})
+	}
+	return networkingv1.IngressRule{IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths}}}
+}
+
+// serviceBackend returns an ingress backend routing to the named service.
+func serviceBackend(name string) networkingv1.IngressBackend {
+	return networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: name}}
+}
+
+// resourceBackend returns an ingress backend routing to a custom resource rather than a service.
+func resourceBackend(name string) networkingv1.IngressBackend {
+	return networkingv1.IngressBackend{Resource: &corev1.TypedLocalObjectReference{Kind: "StorageBucket", Name: name}}
+}
+
+// newService returns a ClusterIP service in the test namespace selecting the pods with the app label.
+func newService(name, app string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, Selector: map[string]string{"app": app}},
+	}
+}
+
+// backendServices returns the backend service names of the results in the test namespace.
+func backendServices(results map[string][]Result) []string {
+	var names []string
+	for _, r := range results[testNamespace] {
+		names = append(names, r.BackendService)
+	}
+	return names
+}
+
+func TestDiscoverSkipsHostOnlyRules(t *testing.T) {
+	clientset := newClientset(
+		newIngress("host-only", networkingv1.IngressRule{Host: "example.com"}),
+		newService("web", "web"),
+	)
+
+	results, err := Discover(context.Background(), clientset, Options{Namespace: testNamespace})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if got := backendServices(results); len(got) != 0 {
+		t.Errorf("Discover() backend services = %v, want none", got)
+	}
+	if _, ok := results[testNamespace]; !ok {
+		t.Errorf("Discover() did not report namespace %q", testNamespace)
+	}
+}
+
+func TestDiscoverMixedBackends(t *testing.T) {
+	bucket := resourceBackend("static")
+	ingress := newIngress("mixed", httpRule(resourceBackend("assets"), serviceBackend("web")))
+	// A resource default backend is skipped without skipping the rules of the ingress
+	ingress.Spec.DefaultBackend = &bucket
+	clientset := newClientset(ingress, newService("web", "web"))
+
+	results, err := Discover(context.Background(), clientset, Options{Namespace: testNamespace})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	got := backendServices(results)
+	if len(got) != 1 || got[0] != "web" {
+		t.Fatalf("Discover() backend services = %v, want [web]", got)
+	}
+	if r := results[testNamespace][0]; r.Type != TypeIngress || r.Name != "mixed" {
+		t.Errorf("Discover() result = %s %q, want %s %q", r.Type, r.Name, TypeIngress, "mixed")
+	}
+}
+
+func TestDiscoverServiceGetError(t *testing.T) {
+	clientset := newClientset(newIngress("web", httpRule(serviceBackend("web"))))
+	errUnavailable := errors.New("etcd unavailable")
+	clientset.PrependReactor("get", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errUnavailable
+	})
+
+	_, err := Discover(context.Background(), clientset, Options{Namespace: testNamespace})
+	if !errors.Is(err, errUnavailable) {
+		t.Fatalf("Discover() error = %v, want it to wrap %v", err, errUnavailable)
+	}
+	if want := "error whilst getting service: etcd unavailable"; err.Error() != want {
+		t.Errorf("Discover() error = %q, want %q", err, want)
+	}
+}
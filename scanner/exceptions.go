@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// exception accepts a failing check for a service, so it is no longer reported as a failure.
+// Service is matched against the workload (e.g. Deployment/web) when checking pod templates.
+type exception struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	Check     string `json:"check"`
+	Reason    string `json:"reason,omitempty"` // Why the finding has been accepted, for the audit trail
+}
+
+// exceptionsFile is the format of the file read by LoadExceptions.
+type exceptionsFile struct {
+	Exceptions []exception `json:"exceptions"`
+}
+
+// Exceptions holds the loaded exceptions. It is not modified once loaded, so it can be shared by scans of several
+// clusters and by repeated scans.
+type Exceptions struct {
+	exceptions []exception
+}
+
+// LoadExceptions reads and validates the YAML exceptions file at path. Exceptions may reference the built-in checks
+// or the custom rules of policy, which can be nil.
+func LoadExceptions(path string, policy *Policy) (*Exceptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst reading exceptions file: %w", err)
+	}
+	var file exceptionsFile
+	if err := unmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error whilst parsing exceptions file %s: %w", path, err)
+	}
+	for i, e := range file.Exceptions {
+		if e.Namespace == "" || e.Service == "" || e.Check == "" {
+			return nil, fmt.Errorf("exception %d in %s must set namespace, service and check", i+1, path)
+		}
+		if _, ok := checkDescriptions[e.Check]; !ok && !policy.hasRule(e.Check) {
+			return nil, fmt.Errorf("exception %d in %s references unknown check %q", i+1, path, e.Check)
+		}
+	}
+	slog.Debug("Loaded exceptions", "path", path, "count", len(file.Exceptions))
+	return &Exceptions{exceptions: file.Exceptions}, nil
+}
+
+// match returns the index of the exception which the failed finding matches, or -1 when there is none. A nil
+// Exceptions matches nothing.
+func (l *Exceptions) match(f Finding) int {
+	if l == nil {
+		return -1
+	}
+	for i, e := range l.exceptions {
+		if e.Namespace == f.Namespace && e.Service == f.Subject() && e.Check == f.Check {
+			return i
+		}
+	}
+	return -1
+}
+
+// accept returns whether the failed finding matches an exception.
+func (l *Exceptions) accept(f Finding) bool {
+	return l.match(f) >= 0
+}
+
+// logApplied logs each exception which matched at least one of the accepted findings in the report, with the number
+// of findings, so it is clear which failures were suppressed. The findings are counted once the report has been
+// built, so findings merged with those of another service, or truncated by MaxFindings, are not counted.
+func (l *Exceptions) logApplied(report []NamespaceFindings) {
+	if l == nil {
+		return
+	}
+	applied := make([]int, len(l.exceptions))
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Accepted {
+				if i := l.match(f); i >= 0 {
+					applied[i]++
+				}
+			}
+		}
+	}
+	for i, e := range l.exceptions {
+		if applied[i] == 0 {
+			slog.Debug("Exception did not match any findings", "namespace", e.Namespace, "service", e.Service, "check", e.Check)
+			continue
+		}
+		slog.Info("Applied exception", "namespace", e.Namespace, "service", e.Service, "check", e.Check, "reason", e.Reason, "findings", applied[i])
+	}
+}
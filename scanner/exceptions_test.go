@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestLogAppliedPerScan(t *testing.T) {
+	exceptions := &Exceptions{exceptions: []exception{{Namespace: testNamespace, Service: "web", Check: CheckRunAsNonRoot}}}
+	opts := Options{Namespace: testNamespace, Checks: CheckSet{CheckRunAsNonRoot: true}, Exceptions: exceptions}
+
+	// The scans share the exceptions, as with -serve, -watch and -contexts
+	for scan := 1; scan <= 2; scan++ {
+		logs := captureLogs(t)
+		// The pod's findings for web-canary are merged into those of web, so the exception applies to one finding
+		clientset := newClientset(
+			newIngress("web", httpRule(serviceBackend("web"), serviceBackend("web-canary"))),
+			newService("web", "web"),
+			newService("web-canary", "web"),
+			newPod("web-1", "web", corev1.PodRunning),
+			newPod("web-2", "web", corev1.PodRunning),
+		)
+
+		report, err := Scan(context.Background(), clientset, opts)
+		if err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		if f, ok := findingFor(report, CheckRunAsNonRoot); !ok || !f.Accepted {
+			t.Fatalf("Scan() = %+v, want an accepted %s finding", report, CheckRunAsNonRoot)
+		}
+		if !strings.Contains(logs.String(), `msg="Applied exception"`) || !strings.Contains(logs.String(), "findings=1") {
+			t.Errorf("scan %d logs = %s, want the exception applied to 1 finding", scan, logs)
+		}
+	}
+}
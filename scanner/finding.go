@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Finding stores the outcome of a single security context check against a pod or container.
+type Finding struct {
+	Namespace     string `json:"namespace"`
+	Service       string `json:"service"`
+	Type          string `json:"type"`                    // How the service was discovered: ingress, httproute, loadbalancer, clusterip or workload
+	Ingress       string `json:"ingress"`                 // Ingress or route name, or the service name for load balancer based routes
+	Workload      string `json:"workload,omitempty"`      // Kind/name of the workload controller, when checking its pod template
+	Pod           string `json:"pod"`                     // Empty when checking a workload's pod template
+	OwnerKind     string `json:"ownerKind,omitempty"`     // Kind of the workload owning the pod, e.g. Deployment, or Pod when it has no controller
+	Owner         string `json:"owner,omitempty"`         // Name of the workload owning the pod, which is stable across restarts unlike the pod name
+	Container     string `json:"container,omitempty"`     // Empty for pod level checks
+	ContainerType string `json:"containerType,omitempty"` // container, initContainer or ephemeralContainer
+	Image         string `json:"image,omitempty"`         // Image of the container, or all of the pod's images for pod level checks
+	ApprovedImage *bool  `json:"approvedImage,omitempty"` // Whether the image matches an approved prefix. Nil when no approved images are given
+	Check         string `json:"check"`
+	Severity      string `json:"severity"` // Severity of the check if it fails
+	Passed        bool   `json:"passed"`
+	Accepted      bool   `json:"accepted,omitempty"` // A failure which matches an entry in the exceptions file
+	Detail        string `json:"detail,omitempty"`   // Additional context about a failure, e.g. the offending capabilities
+	Fingerprint   string `json:"fingerprint"`        // Stable ID of the finding across scans, from its namespace, owner, container and check
+	Baseline      string `json:"baseline,omitempty"` // new, existing or resolved compared with the baseline report. Empty without one
+
+	// The number of the service's active pods which fail the check, out of the total, e.g. a partial failure mid-rollout.
+	// Only set for failures found by listing the pods behind a service
+	AffectedPods int `json:"affectedPods,omitempty"`
+	TotalPods    int `json:"totalPods,omitempty"`
+
+	// SharedWith lists the other services which select the same pod, whose duplicate findings were merged into this one
+	SharedWith []string `json:"sharedWith,omitempty"`
+
+	// NamespaceOwner is the value of the OwnerLabel on the finding's namespace, e.g. the team which owns it, so the
+	// finding can be routed to them. Empty when no label was requested or the namespace does not have it
+	NamespaceOwner string `json:"namespaceOwner,omitempty"`
+
+	// Cluster is the name of the cluster the finding was found in, when scanning several clusters at once
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// addSharedWith records that the finding's pod is also behind the service, unless it is already listed.
+func (f *Finding) addSharedWith(service string) {
+	if service == "" || service == f.Service {
+		return
+	}
+	for _, s := range f.SharedWith {
+		if s == service {
+			return
+		}
+	}
+	f.SharedWith = append(f.SharedWith, service)
+}
+
+// AffectedReplicas returns the number of pods which fail the check out of the total, e.g. 3/5, or an empty string
+// when they were not counted.
+func (f Finding) AffectedReplicas() string {
+	if f.TotalPods == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", f.AffectedPods, f.TotalPods)
+}
+
+// Subject returns the service the finding relates to, or the workload when checking a pod template.
+func (f Finding) Subject() string {
+	if f.Service != "" {
+		return f.Service
+	}
+	return f.Workload
+}
+
+// AtOrAbove returns whether the finding's severity is at or above the given severity.
+func (f Finding) AtOrAbove(severity string) bool {
+	return severityRanks[f.Severity] >= severityRanks[severity]
+}
+
+// Failed returns whether the finding is a failure which has not been accepted by an exception.
+func (f Finding) Failed() bool {
+	return !f.Passed && !f.Accepted
+}
+
+// Status returns the pass/fail/accepted status of the finding as a string.
+func (f Finding) Status() string {
+	if f.Passed {
+		return "pass"
+	}
+	if f.Accepted {
+		return "accepted"
+	}
+	return "fail"
+}
+
+// MarshalJSON adds the status of the finding, as returned by Status, to its fields, so the structured output states
+// whether each check passed, failed or was accepted without consumers deriving it from passed and accepted.
+func (f Finding) MarshalJSON() ([]byte, error) {
+	type finding Finding // Without this method, so marshalling it does not recurse
+	return json.Marshal(struct {
+		finding
+		Status string `json:"status"`
+	}{finding(f), f.Status()})
+}
+
+// NamespaceFindings groups the findings for a single namespace.
+// Namespaces which were scanned but have no findings are still included with an empty slice.
+type NamespaceFindings struct {
+	Namespace string    `json:"namespace"`
+	Cluster   string    `json:"cluster,omitempty"` // Name of the cluster the namespace is in. Empty when scanning a single cluster
+	Findings  []Finding `json:"findings"`
+}
+
+// Failures returns the number of failed findings in the report which have not been accepted by an exception.
+func Failures(report []NamespaceFindings) int {
+	failures := 0
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Failed() {
+				failures++
+			}
+		}
+	}
+	return failures
+}
+
+// GatingFailures returns the number of failed findings in the report for the gating checks, which should fail the
+// scan. A nil gating CheckSet counts the failures of every check, the same as Failures.
+func GatingFailures(report []NamespaceFindings, gating CheckSet) int {
+	failures := 0
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Failed() && gating.Enabled(f.Check) {
+				failures++
+			}
+		}
+	}
+	return failures
+}
@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+)
+
+// processHTTPRoutes adds the backend services referenced by Gateway API HTTPRoute resources to the results map.
+// Backends are deduplicated against those which have already been discovered from ingresses. When WarnMissingBackends is set,
+// backends referencing a service which does not exist are reported as a finding.
+func processHTTPRoutes(ctx context.Context, clientset kubernetes.Interface, gatewayClientset gatewayclient.Interface, results map[string][]Result, added map[string]bool, opts Options) error {
+	routes, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]gatewayv1.HTTPRoute, string, error) {
+		list, err := gatewayClientset.GatewayV1().HTTPRoutes(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("HTTPRoute resources are not available, is the Gateway API installed in the cluster?: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("error whilst listing HTTPRoutes: %w", err)
+	}
+	slog.Info("Found HTTPRoute resources", "count", len(routes))
+
+	for _, route := range routes {
+		for _, rule := range route.Spec.Rules {
+			for _, ref := range rule.BackendRefs {
+				if !isServiceBackendRef(ref.BackendObjectReference) {
+					continue
+				}
+
+				// Backends can reference services in another namespace when permitted by a ReferenceGrant
+				backendNamespace := route.Namespace
+				if ref.Namespace != nil {
+					backendNamespace = string(*ref.Namespace)
+				}
+
+				if err := addBackendService(ctx, clientset, results, added, TypeHTTPRoute, backendNamespace, route.Name, string(ref.Name), opts.WarnMissingBackends); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// isServiceBackendRef returns whether the backend reference points at a core k8s service, which is the default
+// when the group and kind are omitted.
+func isServiceBackendRef(ref gatewayv1.BackendObjectReference) bool {
+	if ref.Group != nil && *ref.Group != "" {
+		return false
+	}
+	if ref.Kind != nil && *ref.Kind != "Service" {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LoadApprovedImages reads the image name prefixes from the file at path, one per line. Blank lines and lines
+// starting with # are ignored.
+func LoadApprovedImages(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst reading approved images file: %w", err)
+	}
+	defer file.Close()
+
+	prefixes := []string{}
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefixes = append(prefixes, line)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("error whilst reading approved images file: %w", err)
+	}
+	return prefixes, nil
+}
+
+// imagesApproved returns whether every image in the comma separated list matches one of the approved prefixes.
+func imagesApproved(images string, prefixes []string) bool {
+	for _, image := range strings.Split(images, ",") {
+		approved := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(image, prefix) {
+				approved = true
+				break
+			}
+		}
+		if !approved {
+			return false
+		}
+	}
+	return true
+}
+
+// podImages returns the unique images of all the containers in the pod as a comma separated list, in the order
+// they are first used.
+func podImages(containers []typedContainer) string {
+	var images []string
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		if c.container.Image == "" || seen[c.container.Image] {
+			continue
+		}
+		seen[c.container.Image] = true
+		images = append(images, c.container.Image)
+	}
+	return strings.Join(images, ",")
+}
+
+// Details of the LatestImageTag check, describing why the image reference is mutable.
+const (
+	imageLatest   = "latest"
+	imageUntagged = "untagged"
+	imageInvalid  = "invalid"
+)
+
+// containerLatestImageTag checks the container's image is pinned to a tag other than latest, or to a digest, so the
+// image which runs is reproducible. References are parsed as the container runtime does, so registry ports (e.g.
+// registry:5000/app) are not mistaken for tags.
+func containerLatestImageTag(_ podContext, c corev1.Container) (bool, string, bool) {
+	named, err := reference.ParseNormalizedNamed(c.Image)
+	if err != nil {
+		return false, imageInvalid, true
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return true, "", true
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return false, imageUntagged, true
+	}
+	if tagged.Tag() == imageLatest {
+		return false, imageLatest, true
+	}
+	return true, "", true
+}
@@ -0,0 +1,315 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// LoadManifests decodes the Kubernetes objects in the YAML or JSON manifest at path, or in every .yaml, .yml and
+// .json file under path when it is a directory. Files can contain multiple YAML documents and List objects.
+// Objects of kinds which are not built in to Kubernetes, such as custom resources, are skipped.
+func LoadManifests(path string) ([]runtime.Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst reading manifest: %w", err)
+	}
+
+	var files []string
+	if info.IsDir() {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".yaml", ".yml", ".json":
+				if !d.IsDir() {
+					files = append(files, p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error whilst listing manifests: %w", err)
+		}
+	} else {
+		files = []string{path}
+	}
+
+	var objects []runtime.Object
+	for _, file := range files {
+		decoded, err := decodeManifestFile(file)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+	slog.Info("Loaded manifests", "files", len(files), "objects", len(objects))
+
+	return objects, nil
+}
+
+// decodeManifestFile decodes each of the YAML documents in the file.
+func decodeManifestFile(file string) ([]runtime.Object, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst opening manifest: %w", err)
+	}
+	defer f.Close()
+
+	var objects []runtime.Object
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error whilst reading manifest %s: %w", file, err)
+		}
+		decoded, err := decodeManifest(doc)
+		if err != nil {
+			return nil, fmt.Errorf("error whilst decoding manifest %s: %w", file, err)
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+// decodeManifest decodes a single YAML or JSON document, expanding List objects into their items.
+func decodeManifest(doc []byte) ([]runtime.Object, error) {
+	if len(bytes.TrimSpace(doc)) == 0 {
+		return nil, nil
+	}
+
+	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		slog.Debug("Skipping manifest of unsupported kind", "err", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.(*corev1.List)
+	if !ok {
+		return []runtime.Object{obj}, nil
+	}
+	slog.Debug("Expanding list manifest", "kind", gvk.Kind, "items", len(list.Items))
+	var objects []runtime.Object
+	for _, item := range list.Items {
+		decoded, err := decodeManifest(item.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+// manifestWorkload is the pod template of a workload controller decoded from a manifest.
+type manifestWorkload struct {
+	kind      string
+	name      string
+	namespace string
+	template  corev1.PodTemplateSpec
+}
+
+// DiscoverManifests returns the services which have an ingress route (an ingress rule or load balancer service) in
+// the decoded manifests, plus any workloads and ClusterIP services enabled in opts, keyed by namespace in the same way
+// as Discover. As there are no running pods, each service is resolved to the pod templates of the Deployments,
+// StatefulSets, DaemonSets, CronJobs and Jobs it selects. Objects without a namespace are placed in the default namespace.
+func DiscoverManifests(objects []runtime.Object, opts Options) (map[string][]Result, error) {
+	ingressSelector, err := labels.Parse(opts.IngressSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst parsing ingress selector: %w", err)
+	}
+	serviceSelector, err := labels.Parse(opts.ServiceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst parsing service selector: %w", err)
+	}
+
+	namespaceOf := func(namespace string) string {
+		if namespace == "" {
+			return corev1.NamespaceDefault
+		}
+		return namespace
+	}
+
+	var (
+		ingresses []networkingv1.Ingress
+		services  = make(map[string]corev1.Service) // keyed by namespace/name
+		workloads []manifestWorkload
+	)
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *networkingv1.Ingress:
+			if ingressSelector.Matches(labels.Set(o.Labels)) {
+				ingresses = append(ingresses, *o)
+			}
+		case *corev1.Service:
+			services[namespaceOf(o.Namespace)+"/"+o.Name] = *o
+		case *appsv1.Deployment:
+			workloads = append(workloads, manifestWorkload{kind: "Deployment", name: o.Name, namespace: namespaceOf(o.Namespace), template: o.Spec.Template})
+		case *appsv1.StatefulSet:
+			workloads = append(workloads, manifestWorkload{kind: "StatefulSet", name: o.Name, namespace: namespaceOf(o.Namespace), template: o.Spec.Template})
+		case *appsv1.DaemonSet:
+			workloads = append(workloads, manifestWorkload{kind: "DaemonSet", name: o.Name, namespace: namespaceOf(o.Namespace), template: o.Spec.Template})
+		case *batchv1.CronJob:
+			workloads = append(workloads, manifestWorkload{kind: "CronJob", name: o.Name, namespace: namespaceOf(o.Namespace), template: o.Spec.JobTemplate.Spec.Template})
+		case *batchv1.Job:
+			workloads = append(workloads, manifestWorkload{kind: "Job", name: o.Name, namespace: namespaceOf(o.Namespace), template: o.Spec.Template})
+		}
+	}
+	ingresses = filterIngressClass(ingresses, opts.IngressClass)
+	slog.Info("Found manifest resources", "ingresses", len(ingresses), "services", len(services), "workloads", len(workloads))
+
+	results := make(map[string][]Result)
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 && opts.Namespace != "" {
+		namespaces = []string{opts.Namespace}
+	}
+	scoped := make(map[string]bool, len(namespaces)) // The namespaces in scope, or empty for all namespaces
+	for _, namespace := range namespaces {
+		// Ensure the namespace is reported even if no services are found
+		results[namespace] = nil
+		scoped[namespace] = true
+	}
+	inScope := func(namespace string) bool {
+		return len(scoped) == 0 || scoped[namespace]
+	}
+
+	added := make(map[string]bool)   // namespace/service, so each service is only checked once
+	checked := make(map[string]bool) // namespace/kind/name of the workloads which are checked via a service
+	addService := func(resultType, namespace, ingressName, serviceName string, warnMissing bool) {
+		key := namespace + "/" + serviceName
+		if added[key] {
+			return
+		}
+		svc, ok := services[key]
+		if !ok {
+			if warnMissing {
+				added[key] = true
+				results[namespace] = append(results[namespace], Result{Type: resultType, Name: ingressName, Namespace: namespace, BackendService: serviceName, Missing: true})
+			}
+			return
+		}
+		if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+			return
+		}
+		added[key] = true
+
+		selector := labels.SelectorFromSet(svc.Spec.Selector)
+		matched := 0
+		for _, wl := range workloads {
+			if wl.namespace != namespace || !selector.Matches(labels.Set(wl.template.Labels)) {
+				continue
+			}
+			matched++
+			checked[wl.namespace+"/"+wl.kind+"/"+wl.name] = true
+			template := wl.template
+			results[namespace] = append(results[namespace], Result{
+				Type:             resultType,
+				Name:             wl.name,
+				Namespace:        namespace,
+				BackendService:   serviceName,
+				ServiceSelectors: svc.Spec.Selector,
+				WorkloadKind:     wl.kind,
+				Template:         &template,
+			})
+		}
+		if matched == 0 {
+			slog.Info("No workloads found for service in the manifests, skipping", "ingress", ingressName, "service", serviceName, "namespace", namespace)
+		}
+	}
+
+	// Check for services which have at least 1 ingress route. Resource backends (rather than services) are skipped
+	for _, i := range ingresses {
+		namespace := namespaceOf(i.Namespace)
+		if !inScope(namespace) {
+			continue
+		}
+		if i.Spec.DefaultBackend != nil && i.Spec.DefaultBackend.Service != nil {
+			addService(TypeIngress, namespace, i.Name, i.Spec.DefaultBackend.Service.Name, opts.WarnMissingBackends)
+		}
+		for _, h := range i.Spec.Rules {
+			if h.HTTP == nil {
+				continue
+			}
+			for _, p := range h.HTTP.Paths {
+				if p.Backend.Service != nil {
+					addService(TypeIngress, namespace, i.Name, p.Backend.Service.Name, opts.WarnMissingBackends)
+				}
+			}
+		}
+	}
+
+	// Check for services which have a LoadBalancer ingress, and optionally ClusterIP services
+	for _, svc := range services {
+		namespace := namespaceOf(svc.Namespace)
+		if !inScope(namespace) || !serviceSelector.Matches(labels.Set(svc.Labels)) {
+			continue
+		}
+		switch svc.Spec.Type {
+		case corev1.ServiceTypeLoadBalancer:
+			addService(TypeLoadBalancer, namespace, svc.Name, svc.Name, false)
+		case corev1.ServiceTypeClusterIP, "":
+			if opts.IncludeClusterIP {
+				addService(TypeClusterIP, namespace, svc.Name, svc.Name, false)
+			}
+		}
+	}
+
+	// Check the remaining workload controllers, regardless of whether they are reachable via an ingress route
+	if opts.AllWorkloads {
+		for _, wl := range workloads {
+			if !inScope(wl.namespace) || checked[wl.namespace+"/"+wl.kind+"/"+wl.name] {
+				continue
+			}
+			template := wl.template
+			results[wl.namespace] = append(results[wl.namespace], Result{
+				Type:         TypeWorkload,
+				Name:         wl.name,
+				Namespace:    wl.namespace,
+				WorkloadKind: wl.kind,
+				Template:     &template,
+			})
+		}
+	}
+
+	totalResults := 0
+	for _, v := range results {
+		totalResults += len(v)
+	}
+	slog.Info("Services to check (after filtering)", "count", totalResults)
+
+	return results, nil
+}
+
+// ScanManifests checks the security contexts of the services with an ingress route in the decoded manifests, without
+// connecting to a cluster. See DiscoverManifests and Check. Service accounts are not looked up, so the service account
+// token check only considers the pod template.
+func ScanManifests(ctx context.Context, objects []runtime.Object, opts Options) ([]NamespaceFindings, error) {
+	results, err := DiscoverManifests(objects, opts)
+	if err != nil {
+		return nil, err
+	}
+	return Check(ctx, nil, results, opts)
+}
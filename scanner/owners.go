@@ -0,0 +1,35 @@
+package scanner
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podOwner returns the kind and name of the workload controlling the pod, such as a Deployment, StatefulSet,
+// DaemonSet or Job, as pod names are ephemeral and cannot be edited. ReplicaSets are followed up to their Deployment.
+// The pod itself is returned when it has no controller.
+func podOwner(ctx context.Context, replicaSets *onceCache[appsv1.ReplicaSet], pod corev1.Pod) (string, string, error) {
+	owner := metav1.GetControllerOf(&pod)
+	if owner == nil {
+		return "Pod", pod.Name, nil
+	}
+	if owner.Kind != "ReplicaSet" {
+		return owner.Kind, owner.Name, nil
+	}
+
+	rs, err := replicaSets.get(ctx, pod.Namespace, owner.Name)
+	if err != nil {
+		return "", "", err
+	}
+	// A ReplicaSet which has been deleted, or was created directly, is reported as the owner
+	if rs == nil {
+		return owner.Kind, owner.Name, nil
+	}
+	if deployment := metav1.GetControllerOf(rs); deployment != nil {
+		return deployment.Kind, deployment.Name, nil
+	}
+	return owner.Kind, owner.Name, nil
+}
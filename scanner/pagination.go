@@ -0,0 +1,27 @@
+package scanner
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultPageSize is the default number of items requested per List call.
+const DefaultPageSize = 500
+
+// listAll calls list repeatedly, following the continue token, until every page has been read. Requesting pageSize
+// items at a time keeps each API response bounded on very large clusters. A pageSize of 0 disables pagination.
+// list should return the items in the page and the continue token from the list metadata.
+func listAll[T any](pageSize int64, opts metav1.ListOptions, list func(opts metav1.ListOptions) ([]T, string, error)) ([]T, error) {
+	var all []T
+	opts.Limit = pageSize
+	for {
+		items, next, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if next == "" {
+			return all, nil
+		}
+		opts.Continue = next
+	}
+}
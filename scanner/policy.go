@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Levels a policy rule can be evaluated at.
+const (
+	policyLevelPod       = "pod"
+	policyLevelContainer = "container"
+)
+
+// Operators supported by policy rules. A rule passes when its operator holds for the field's value.
+const (
+	policyEquals     = "equals"
+	policyNotEquals  = "notEquals"
+	policyIn         = "in"
+	policyNotIn      = "notIn"
+	policyExists     = "exists"
+	policyNotExists  = "notExists"
+	policyMatches    = "matches"
+	policyNotMatches = "notMatches"
+)
+
+// policyRule is a custom check which compares a single field of each pod (or container) against a value.
+// Field is a dot separated path into the object as it appears in a manifest, e.g. spec.hostNetwork at the pod level,
+// or securityContext.runAsUser at the container level.
+type policyRule struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"` // Documents the rule in the policy file
+	Severity    string        `json:"severity,omitempty"`    // Defaults to medium
+	Level       string        `json:"level"`                 // pod or container
+	Field       string        `json:"field"`
+	Operator    string        `json:"operator"`
+	Value       interface{}   `json:"value,omitempty"`  // Used by equals, notEquals, matches and notMatches
+	Values      []interface{} `json:"values,omitempty"` // Used by in and notIn
+
+	pattern *regexp.Regexp // Compiled from Value for matches and notMatches
+}
+
+// policyFile is the format of the file read by LoadPolicy.
+type policyFile struct {
+	Rules []policyRule `json:"rules"`
+}
+
+// Policy holds the custom rules which are checked in addition to the built-in checks.
+type Policy struct {
+	rules []policyRule
+}
+
+// LoadPolicy reads and validates the YAML policy file of custom rules at path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst reading policy file: %w", err)
+	}
+	var file policyFile
+	if err := unmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error whilst parsing policy file %s: %w", path, err)
+	}
+
+	// Check names are matched case insensitively by ParseChecks, so rules must differ from the built-in checks, and
+	// each other, by more than case
+	names := make(map[string]bool, len(checkDescriptions)+len(file.Rules))
+	for name := range checkDescriptions {
+		names[strings.ToLower(name)] = true
+	}
+	for i := range file.Rules {
+		r := &file.Rules[i]
+		if r.Name == "" || r.Field == "" || r.Operator == "" {
+			return nil, fmt.Errorf("rule %d in %s must set name, field and operator", i+1, path)
+		}
+		if names[strings.ToLower(r.Name)] {
+			return nil, fmt.Errorf("rule %d in %s has the name %q of another check", i+1, path, r.Name)
+		}
+		names[strings.ToLower(r.Name)] = true
+		if r.Level != policyLevelPod && r.Level != policyLevelContainer {
+			return nil, fmt.Errorf("rule %q in %s has unsupported level %q, must be one of: pod, container", r.Name, path, r.Level)
+		}
+		if r.Severity == "" {
+			r.Severity = SeverityMedium
+		}
+		if !ValidSeverity(r.Severity) {
+			return nil, fmt.Errorf("rule %q in %s has unsupported severity %q, must be one of: critical, high, medium, low", r.Name, path, r.Severity)
+		}
+
+		switch r.Operator {
+		case policyEquals, policyNotEquals, policyExists, policyNotExists:
+		case policyIn, policyNotIn:
+			if len(r.Values) == 0 {
+				return nil, fmt.Errorf("rule %q in %s must set values for the %s operator", r.Name, path, r.Operator)
+			}
+		case policyMatches, policyNotMatches:
+			r.pattern, err = regexp.Compile(fmt.Sprint(r.Value))
+			if err != nil {
+				return nil, fmt.Errorf("rule %q in %s has an invalid pattern: %w", r.Name, path, err)
+			}
+		default:
+			return nil, fmt.Errorf("rule %q in %s has unsupported operator %q, must be one of: %s", r.Name, path, r.Operator,
+				strings.Join([]string{policyEquals, policyNotEquals, policyIn, policyNotIn, policyExists, policyNotExists, policyMatches, policyNotMatches}, ", "))
+		}
+	}
+	slog.Debug("Loaded policy", "path", path, "rules", len(file.Rules))
+	return &Policy{rules: file.Rules}, nil
+}
+
+// hasRule returns whether the policy has a custom rule with the name. A nil Policy has none.
+func (p *Policy) hasRule(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate returns whether the rule passes for the object, and the field's value (or unset) as the detail of a
+// failure.
+// Fields which are unset pass the negative operators (notEquals, notIn, notExists and notMatches) and fail the rest.
+func (r policyRule) evaluate(obj interface{}) (bool, string) {
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		slog.Error("Error whilst converting object for policy rule", "rule", r.Name, "err", err)
+		return false, "unset"
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(fields, strings.Split(r.Field, ".")...)
+	if err != nil || value == nil {
+		found = false
+	}
+
+	detail := "unset"
+	if found {
+		detail = fmt.Sprint(value)
+	}
+
+	var passed bool
+	switch r.Operator {
+	case policyEquals:
+		passed = found && detail == fmt.Sprint(r.Value)
+	case policyNotEquals:
+		passed = !found || detail != fmt.Sprint(r.Value)
+	case policyIn, policyNotIn:
+		in := false
+		for _, v := range r.Values {
+			if found && detail == fmt.Sprint(v) {
+				in = true
+			}
+		}
+		passed = in == (r.Operator == policyIn)
+	case policyExists:
+		passed = found
+	case policyNotExists:
+		passed = !found
+	case policyMatches:
+		passed = found && r.pattern.MatchString(detail)
+	case policyNotMatches:
+		passed = !found || !r.pattern.MatchString(detail)
+	}
+	if passed {
+		return true, ""
+	}
+	return false, detail
+}
+
+// securityChecks returns the policy's rules as checks, which run after the built-in checks. A nil Policy has none.
+func (p *Policy) securityChecks() []securityCheck {
+	if p == nil {
+		return nil
+	}
+	checks := make([]securityCheck, 0, len(p.rules))
+	for _, r := range p.rules {
+		r := r
+		check := securityCheck{name: r.Name, severity: r.Severity}
+		if r.Level == policyLevelPod {
+			check.pod = func(p podContext) (bool, string, bool) {
+				passed, detail := r.evaluate(&p.pod)
+				return passed, detail, true
+			}
+		} else {
+			check.container = func(_ podContext, c corev1.Container) (bool, string, bool) {
+				passed, detail := r.evaluate(&c)
+				return passed, detail, true
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
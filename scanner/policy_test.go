@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes the content to a file named name in a temporary directory, returning its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testPolicy loads a policy with a single critical custom rule named RunAsUserSet.
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := LoadPolicy(writeFile(t, "policy.yaml", `
+rules:
+  - name: RunAsUserSet
+    severity: critical
+    level: pod
+    field: spec.securityContext.runAsUser
+    operator: exists
+`))
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	return policy
+}
+
+func TestParseChecksPolicyRules(t *testing.T) {
+	policy := testPolicy(t)
+
+	gating, err := ParseChecks("privileged,runasuserset", policy)
+	if err != nil {
+		t.Fatalf("ParseChecks() error = %v", err)
+	}
+	if !gating.Enabled(CheckPrivileged) || !gating.Enabled("RunAsUserSet") {
+		t.Errorf("ParseChecks() = %v, want Privileged and RunAsUserSet", gating)
+	}
+	if _, err := ParseChecks("runasuserset", nil); err == nil {
+		t.Error("ParseChecks() without the policy error = nil, want an unknown check")
+	}
+}
+
+func TestLoadExceptionsPolicyRules(t *testing.T) {
+	path := writeFile(t, "exceptions.yaml", `
+exceptions:
+  - namespace: payments
+    service: web
+    check: RunAsUserSet
+`)
+
+	if _, err := LoadExceptions(path, testPolicy(t)); err != nil {
+		t.Errorf("LoadExceptions() error = %v", err)
+	}
+	if _, err := LoadExceptions(path, nil); err == nil {
+		t.Error("LoadExceptions() without the policy error = nil, want an unknown check")
+	}
+}
+
+func TestLoadPolicyNameCollisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "built-in check", rules: "  - {name: Privileged, level: pod, field: spec.hostNetwork, operator: exists}\n"},
+		{name: "built-in check in another case", rules: "  - {name: privileged, level: pod, field: spec.hostNetwork, operator: exists}\n"},
+		{name: "rules in another case", rules: "  - {name: RunAsUserSet, level: pod, field: spec.hostNetwork, operator: exists}\n" +
+			"  - {name: runasuserset, level: pod, field: spec.hostNetwork, operator: exists}\n"},
+	}
+	for _, tt := range tests {
+		if _, err := LoadPolicy(writeFile(t, "policy.yaml", "rules:\n"+tt.rules)); err == nil {
+			t.Errorf("%s: LoadPolicy() error = nil, want a name collision", tt.name)
+		}
+	}
+}
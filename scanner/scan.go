@@ -0,0 +1,470 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	gatewayclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+)
+
+// failureSignature returns a key describing which checks failed for a pod, independent of the pod name.
+// Replicas which fail in exactly the same way share a signature, so only one of them needs reporting.
+func failureSignature(findings []Finding) string {
+	var failed []string
+	for _, f := range findings {
+		if !f.Passed {
+			failed = append(failed, f.Container+"/"+f.Check+"/"+f.Detail)
+		}
+	}
+	sort.Strings(failed)
+	return strings.Join(failed, ",")
+}
+
+// activePods returns the pods which reflect the current desired state, newest first. Pods which are terminating
+// (e.g. from a previous ReplicaSet during a rollout) or have failed or completed are skipped.
+// The cached slice is shared between workers, so a new slice is returned rather than sorting in place.
+func activePods(pods []corev1.Pod) []corev1.Pod {
+	active := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		active = append(active, pod)
+	}
+	sort.SliceStable(active, func(a, b int) bool {
+		return active[b].CreationTimestamp.Before(&active[a].CreationTimestamp)
+	})
+	return active
+}
+
+// maturePods returns the pods which were created at least minAge before now, so pods which may still be settling,
+// e.g. mid-rollout, are not evaluated. The order is preserved.
+func maturePods(pods []corev1.Pod, minAge time.Duration, now time.Time) []corev1.Pod {
+	mature := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if now.Sub(pod.CreationTimestamp.Time) >= minAge {
+			mature = append(mature, pod)
+		}
+	}
+	return mature
+}
+
+// serviceCheck is a unit of work for the Check worker pool.
+type serviceCheck struct {
+	index  int // Position of the service in the work queue, used to keep the output order deterministic
+	result Result
+}
+
+// serviceFindings stores the findings for a single service once all of its pods have been checked.
+type serviceFindings struct {
+	index      int
+	result     Result
+	noPods     bool // No pods were found behind the service so nothing was checked
+	inactive   int  // The number of pods behind the service which were skipped as they are not active
+	tooNew     int  // The number of active pods which were skipped as they are younger than the minimum pod age
+	noSelector bool // The service has no selector, so its endpoints are managed externally and nothing was checked
+	findings   []Finding
+}
+
+// checkService lists the pods behind a single service and runs the checks against each of them.
+// Pods are listed via the cache, so services sharing a selector are only listed once.
+// Only the given checks are run. serviceAccounts is nil when the service account token check is disabled.
+// Each finding references the workload owning the pod, which is resolved via replicaSets for Deployments.
+// When useEndpoints is set, the pods are those targeted by the service's EndpointSlices, falling back to the selector
+// when it has none. Pods younger than minPodAge are skipped. Pod templates are always checked.
+func checkService(ctx context.Context, cache *podCache, serviceAccounts *onceCache[corev1.ServiceAccount], replicaSets *onceCache[appsv1.ReplicaSet], checks []securityCheck, compliance Compliance, useEndpoints bool, minPodAge time.Duration, job serviceCheck) (serviceFindings, error) {
+	i := job.result
+	sf := serviceFindings{index: job.index, result: i}
+
+	check := func(pod corev1.Pod) ([]Finding, error) {
+		var sa *corev1.ServiceAccount
+		if serviceAccounts != nil {
+			var err error
+			sa, err = serviceAccounts.get(ctx, i.Namespace, serviceAccountName(pod))
+			if err != nil {
+				return nil, err
+			}
+		}
+		findings := checkPod(i, pod, sa, checks, compliance)
+
+		ownerKind, ownerName := i.WorkloadKind, i.Name
+		if i.Template == nil {
+			var err error
+			ownerKind, ownerName, err = podOwner(ctx, replicaSets, pod)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for j := range findings {
+			findings[j].OwnerKind = ownerKind
+			findings[j].Owner = ownerName
+		}
+		return findings, nil
+	}
+
+	if i.Missing {
+		sf.findings = []Finding{{
+			Namespace: i.Namespace,
+			Service:   i.BackendService,
+			Type:      i.Type,
+			Ingress:   i.Name,
+			Check:     CheckBackendServiceNotFound,
+			Severity:  CheckSeverity(CheckBackendServiceNotFound),
+			Detail:    i.BackendService,
+		}}
+		return sf, nil
+	}
+
+	// Workload controllers are checked against their pod template, so there are no pods to list
+	if i.Template != nil {
+		findings, err := check(corev1.Pod{ObjectMeta: i.Template.ObjectMeta, Spec: i.Template.Spec})
+		sf.findings = findings
+		return sf, err
+	}
+
+	var (
+		listed []corev1.Pod
+		found  bool
+		err    error
+	)
+	if useEndpoints {
+		listed, found, err = cache.endpointPods(ctx, i.Namespace, i.BackendService)
+		if err != nil {
+			return sf, err
+		}
+		if !found {
+			slog.Info("No EndpointSlices found, falling back to the service selector", "service", i.BackendService, "namespace", i.Namespace)
+		}
+	}
+	if !found {
+		// An empty selector would list every pod in the namespace, whereas the service routes to none of them
+		if len(i.ServiceSelectors) == 0 {
+			sf.noSelector = true
+			return sf, nil
+		}
+
+		labelSelector := metav1.LabelSelector{MatchLabels: i.ServiceSelectors}
+		listed, err = cache.list(ctx, i.Namespace, labels.Set(labelSelector.MatchLabels).String())
+		if err != nil {
+			return sf, err
+		}
+	}
+	pods := activePods(listed)
+	sf.inactive = len(listed) - len(pods)
+	if minPodAge > 0 {
+		active := len(pods)
+		pods = maturePods(pods, minPodAge, time.Now())
+		sf.tooNew = active - len(pods)
+		if sf.tooNew > 0 && len(pods) > 0 {
+			slog.Debug("Skipping pods which are too new to evaluate", "service", i.BackendService, "namespace", i.Namespace, "pods", sf.tooNew, "minPodAge", minPodAge)
+		}
+	}
+
+	if len(pods) <= 0 {
+		sf.noPods = true
+		return sf, nil
+	}
+
+	// Pending pods are still checked, as their security context comes from the spec, but may be transient
+	running := 0
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning {
+			running++
+		}
+	}
+	if running == 0 {
+		slog.Info("No running pods found, checking pods which are not running yet", "service", i.BackendService, "namespace", i.Namespace, "pods", len(pods))
+	}
+
+	// Pods are ordered newest first, so replicas which fail the same checks are reported against the newest pod
+	seen := make(map[string]bool)
+	affected := make(map[string]int) // The number of pods failing each container/check
+	for _, pod := range pods {
+		podFindings, err := check(pod)
+		if err != nil {
+			return sf, err
+		}
+		for _, f := range podFindings {
+			if !f.Passed {
+				affected[f.Container+"/"+f.Check]++
+			}
+		}
+
+		signature := failureSignature(podFindings)
+		if seen[signature] {
+			continue
+		}
+		seen[signature] = true
+
+		sf.findings = append(sf.findings, podFindings...)
+	}
+	for j := range sf.findings {
+		if f := &sf.findings[j]; !f.Passed {
+			f.AffectedPods, f.TotalPods = affected[f.Container+"/"+f.Check], len(pods)
+		}
+	}
+
+	// Pod level findings sort first as they have no container name. The order of the checks is preserved
+	sort.SliceStable(sf.findings, func(a, b int) bool {
+		fa, fb := sf.findings[a], sf.findings[b]
+		if fa.Pod != fb.Pod {
+			return fa.Pod < fb.Pod
+		}
+		return fa.Container < fb.Container
+	})
+
+	return sf, nil
+}
+
+// reportedFindings returns the findings at or above opts.MinSeverity, marking failures which match opts.Exceptions
+// as accepted and annotating whether each image is approved. Each finding is fingerprinted and compared with
+// opts.Baseline.
+func reportedFindings(findings []Finding, opts Options) []Finding {
+	// A check which passes on one replica is not resolved whilst it still fails on another
+	failing := make(map[string]bool)
+	for i := range findings {
+		findings[i].Cluster = opts.Cluster
+		findings[i].Fingerprint = fingerprint(findings[i])
+		if !findings[i].Passed {
+			failing[findings[i].Fingerprint] = true
+		}
+	}
+
+	var reported []Finding
+	for _, f := range findings {
+		if opts.MinSeverity != "" && !f.AtOrAbove(opts.MinSeverity) {
+			continue
+		}
+		if !f.Passed && opts.Exceptions.accept(f) {
+			f.Accepted = true
+		}
+		if !f.Passed || !failing[f.Fingerprint] {
+			f.Baseline = opts.Baseline.status(f)
+		}
+		if opts.ApprovedImages != nil && f.Image != "" {
+			approved := imagesApproved(f.Image, opts.ApprovedImages)
+			f.ApprovedImage = &approved
+		}
+		reported = append(reported, f)
+	}
+	return reported
+}
+
+// duplicateKey identifies the pod (or pod template), container and check of a finding, so a finding is only reported
+// once when several services select the same pods, e.g. two ingresses routing to services with the same selector.
+// Empty for findings which do not relate to a pod.
+func duplicateKey(f Finding) string {
+	target := f.Pod
+	if target == "" {
+		target = f.Workload
+	}
+	if target == "" {
+		return ""
+	}
+	return strings.Join([]string{f.Namespace, target, f.Container, f.Check}, "/")
+}
+
+// truncated returns whether stopFeed has been closed, as the maximum number of findings has been reached.
+func truncated(stopFeed chan struct{}) bool {
+	select {
+	case <-stopFeed:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultConcurrency is the default number of services checked in parallel.
+const DefaultConcurrency = 8
+
+// Options controls which services are discovered and how they are checked. The zero value discovers the services
+// with an ingress route in all namespaces and runs every check against them.
+type Options struct {
+	Namespace       string   // Only scan this namespace. Empty for all namespaces
+	Namespaces      []string // Only scan these namespaces, used instead of Namespace when set. Missing ones are skipped
+	IngressSelector string   // Label selector restricting which ingresses are scanned
+	IngressClass    string   // Only scan ingresses of this class. Empty for all classes
+	ServiceSelector string   // Label selector restricting which LoadBalancer and ClusterIP services are scanned
+	Service         string   // Only check this service, in Namespace, rather than discovering the ingress routes
+
+	GatewayClientset    gatewayclient.Interface // When set, also discover backend services from Gateway API HTTPRoute resources
+	AllWorkloads        bool                    // Also check the pod templates of all Deployments, StatefulSets, DaemonSets, CronJobs and Jobs
+	IncludeClusterIP    bool                    // Also check all ClusterIP services, not just those with an ingress route
+	WarnMissingBackends bool                    // Report ingress backends which reference a service which does not exist
+	UseEndpoints        bool                    // Check the pods targeted by each service's EndpointSlices rather than its selector
+	MinPodAge           time.Duration           // Skip pods created more recently than this, e.g. mid-rollout. 0 to check every pod
+
+	Checks      CheckSet    // The checks to run. Nil for the default checks
+	MinSeverity string      // Only report findings at or above this severity. Empty for all findings
+	Exceptions  *Exceptions // Failures to accept rather than report. Nil for none
+	Policy      *Policy     // Custom rules which are checked after the built-in checks. Nil for none
+	Compliance  Compliance  // What counts as passing for the configurable checks. The zero value is strict
+	Baseline    *Baseline   // A previous report to mark each failure as new, existing or resolved against. Nil for none
+
+	ApprovedImages []string // Image name prefixes used to annotate whether each finding's image is approved. Nil to skip
+	OwnerLabel     string   // Namespace label whose value is set as each finding's NamespaceOwner, e.g. team. Empty to skip
+
+	// Cluster is the name of the cluster being scanned, which is set on each finding and namespace and included in the
+	// fingerprints, so the reports of several clusters can be combined. Empty when scanning a single cluster
+	Cluster string
+
+	// SkipForbidden skips the namespaces where listing pods (or getting a pod's service account or ReplicaSet) is
+	// forbidden by RBAC, rather than aborting the scan, so the rest of the cluster is still checked
+	SkipForbidden bool
+
+	// MaxFindings stops the scan once this many failures have been found, to bound the output of a badly
+	// misconfigured cluster. The report is truncated to the first MaxFindings failures. 0 for no limit
+	MaxFindings int
+
+	Concurrency int   // Number of services to check in parallel. Defaults to DefaultConcurrency when less than 1
+	PageSize    int64 // Number of items requested per List call. 0 disables pagination
+
+	// OnFinding, when set, is called with each reported finding as soon as its service has been checked, so findings
+	// can be streamed rather than waiting for the whole scan. Services complete in any order. Calls are serialised,
+	// so OnFinding does not need to be safe for concurrent use.
+	OnFinding func(Finding)
+
+	// OnProgress, when set, is called with the number of services checked so far and the total after each service has
+	// been checked, e.g. to show the progress of a long scan. Calls are serialised.
+	OnProgress func(checked, total int)
+
+	// OnTruncated, when set, is called once the scan has finished if the report was truncated by MaxFindings, i.e.
+	// failures were left out or services were not checked. It must be safe for concurrent use when shared by the
+	// scans of several clusters.
+	OnTruncated func()
+}
+
+// Scan discovers the services which have an ingress route and checks their security contexts, returning the
+// findings grouped by namespace. See Discover and Check.
+func Scan(ctx context.Context, clientset kubernetes.Interface, opts Options) ([]NamespaceFindings, error) {
+	results, err := Discover(ctx, clientset, opts)
+	if err != nil {
+		return nil, err
+	}
+	return Check(ctx, clientset, results, opts)
+}
+
+// ScanConfig is the same as Scan, but creates the clientset from config, e.g. when embedding the scanner in a test
+// harness which starts its own API server with envtest. The caller controls how config authenticates, so no
+// kubeconfig is loaded. Set opts.GatewayClientset to also discover Gateway API routes.
+func ScanConfig(ctx context.Context, config *rest.Config, opts Options) ([]NamespaceFindings, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst creating the clientset: %w", err)
+	}
+	return Scan(ctx, clientset, opts)
+}
+
+// Check checks whether the services listed in the results map have certain k8s security contexts enabled.
+// Every pod behind each service is checked. Replicas which fail the same checks are only reported once, whilst
+// replicas with divergent security contexts (e.g. mid-rollout) are each reported.
+// Services are checked in parallel by a pool of opts.Concurrency workers. The first error cancels the remaining work.
+// Returns the findings grouped by namespace, sorted by namespace and then service so the order is the same between
+// runs. Failures which match opts.Exceptions are marked as accepted. When opts.SkipForbidden is set, namespaces which
+// return a forbidden error are logged and left out of the report. When opts.MaxFindings is set, no more services are
+// checked once that many failures have been found. Findings for pods behind several services are only reported against
+// the first service, listing the others in SharedWith.
+// clientset can be nil when every result is a pod template, such as those from DiscoverManifests, in which case service
+// accounts are not looked up.
+func Check(ctx context.Context, clientset kubernetes.Interface, results map[string][]Result, opts Options) ([]NamespaceFindings, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Checks == nil {
+		opts.Checks = DefaultChecks()
+	}
+
+	// Queue the services sorted by namespace and then service name, so the output is the same between runs
+	namespaces := make([]string, 0, len(results))
+	for namespace := range results {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var work []serviceCheck
+	for _, namespace := range namespaces {
+		slice := append([]Result(nil), results[namespace]...)
+		sort.SliceStable(slice, func(a, b int) bool {
+			if slice[a].BackendService != slice[b].BackendService {
+				return slice[a].BackendService < slice[b].BackendService
+			}
+			return slice[a].Name < slice[b].Name
+		})
+		for _, r := range slice {
+			work = append(work, serviceCheck{index: len(work), result: r})
+		}
+	}
+
+	var wg sync.WaitGroup
+	collector := newFindingCollector(opts, len(work), cancel)
+	jobs := make(chan serviceCheck)
+	cache := newPodCache(clientset, opts.PageSize)
+	var serviceAccounts *onceCache[corev1.ServiceAccount]
+	if clientset != nil && opts.Checks.Enabled(CheckServiceAccountToken) {
+		serviceAccounts = newServiceAccountCache(clientset)
+	}
+	replicaSets := newReplicaSetCache(clientset)
+	var namespaceOwners *onceCache[corev1.Namespace]
+	if clientset != nil && opts.OwnerLabel != "" {
+		namespaceOwners = newNamespaceCache(clientset)
+	}
+	checks := enabledChecks(opts.Checks, opts.Policy)
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				sf, err := checkService(ctx, cache, serviceAccounts, replicaSets, checks, opts.Compliance, opts.UseEndpoints, opts.MinPodAge, job)
+				if err == nil && namespaceOwners != nil {
+					var owner string
+					owner, err = namespaceOwner(ctx, namespaceOwners, job.result.Namespace, opts.OwnerLabel)
+					for i := range sf.findings {
+						sf.findings[i].NamespaceOwner = owner
+					}
+				}
+				collector.add(job.result.Namespace, sf, err)
+			}
+		}()
+	}
+
+feed:
+	for _, job := range work {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			break feed
+		case <-collector.stopFeed:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if collector.firstErr != nil {
+		return nil, collector.firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	report, cut := collector.report(namespaces)
+	if cut && opts.OnTruncated != nil {
+		opts.OnTruncated()
+	}
+	return report, nil
+}
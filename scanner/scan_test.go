@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newPod returns a pod in the test namespace with the app label, a single container and the given phase.
+func newPod(name, app string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{"app": app}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "example.com/app:1.0"}}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+// findingFor returns the finding for the check in the report, and whether there is one.
+func findingFor(report []NamespaceFindings, check string) (Finding, bool) {
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Check == check {
+				return f, true
+			}
+		}
+	}
+	return Finding{}, false
+}
+
+func TestScan(t *testing.T) {
+	privileged := true
+	pod := newPod("web-1", "web", corev1.PodRunning)
+	pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{Privileged: &privileged}
+	clientset := newClientset(newIngress("web", httpRule(serviceBackend("web"))), newService("web", "web"), pod)
+
+	report, err := Scan(context.Background(), clientset, Options{Namespace: testNamespace, Checks: CheckSet{CheckPrivileged: true}})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(report) != 1 || report[0].Namespace != testNamespace {
+		t.Fatalf("Scan() namespaces = %+v, want only %q", report, testNamespace)
+	}
+	f, ok := findingFor(report, CheckPrivileged)
+	if !ok {
+		t.Fatalf("Scan() findings = %+v, want a %s finding", report[0].Findings, CheckPrivileged)
+	}
+	if !f.Failed() || f.Severity != SeverityCritical {
+		t.Errorf("Scan() %s finding status = %s, severity = %s, want fail, %s", CheckPrivileged, f.Status(), f.Severity, SeverityCritical)
+	}
+	if f.Service != "web" || f.Ingress != "web" || f.Pod != "web-1" || f.Container != "app" || f.OwnerKind != "Pod" {
+		t.Errorf("Scan() finding = %+v, want service web, ingress web, pod web-1, container app, owned by the pod", f)
+	}
+}
+
+func TestScanNoRoutes(t *testing.T) {
+	// The ClusterIP service has no ingress route, so it is not checked
+	clientset := newClientset(newService("web", "web"), newPod("web-1", "web", corev1.PodRunning))
+
+	report, err := Scan(context.Background(), clientset, Options{Namespace: testNamespace})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(report) != 1 || len(report[0].Findings) != 0 {
+		t.Errorf("Scan() = %+v, want namespace %q with no findings", report, testNamespace)
+	}
+}
+
+func TestScanNoSelector(t *testing.T) {
+	// Without a selector, the service's endpoints are managed externally rather than routing to every pod
+	service := newService("external", "")
+	service.Spec.Selector = nil
+	clientset := newClientset(newIngress("external", httpRule(serviceBackend("external"))), service, newPod("web-1", "web", corev1.PodRunning))
+
+	report, err := Scan(context.Background(), clientset, Options{Namespace: testNamespace})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(report) != 1 || len(report[0].Findings) != 0 {
+		t.Errorf("Scan() = %+v, want namespace %q with no findings", report, testNamespace)
+	}
+	if got := podLists(clientset); got != 0 {
+		t.Errorf("pods listed %d times for a service without a selector, want 0", got)
+	}
+
+	sf, err := checkService(context.Background(), newPodCache(clientset, 0), nil, newReplicaSetCache(clientset), nil, Compliance{}, false, 0,
+		serviceCheck{result: Result{Type: TypeIngress, Name: "external", Namespace: testNamespace, BackendService: "external"}})
+	if err != nil {
+		t.Fatalf("checkService() error = %v", err)
+	}
+	if !sf.noSelector || sf.noPods {
+		t.Errorf("checkService() noSelector = %t, noPods = %t, want true, false", sf.noSelector, sf.noPods)
+	}
+}
+
+// captureLogs sends the default logger's output to the returned buffer until the test completes.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestActivePods(t *testing.T) {
+	now := time.Now()
+	pod := func(name string, phase corev1.PodPhase, age time.Duration) corev1.Pod {
+		p := *newPod(name, "web", phase)
+		p.CreationTimestamp = metav1.NewTime(now.Add(-age))
+		return p
+	}
+	terminating := pod("terminating", corev1.PodRunning, time.Minute)
+	terminating.DeletionTimestamp = &metav1.Time{Time: now}
+	pods := []corev1.Pod{
+		pod("running-old", corev1.PodRunning, time.Hour),
+		pod("succeeded", corev1.PodSucceeded, 2*time.Minute),
+		terminating,
+		pod("pending", corev1.PodPending, time.Second),
+		pod("failed", corev1.PodFailed, 3*time.Minute),
+		pod("running-new", corev1.PodRunning, 10*time.Minute),
+		pod("unknown", corev1.PodUnknown, 20*time.Minute),
+	}
+
+	var got []string
+	for _, p := range activePods(pods) {
+		got = append(got, p.Name)
+	}
+	if want := "pending,running-new,unknown,running-old"; strings.Join(got, ",") != want {
+		t.Errorf("activePods() = %v, want %s, newest first", got, want)
+	}
+	if pods[0].Name != "running-old" {
+		t.Errorf("activePods() reordered the cached pods")
+	}
+}
+
+func TestCheckServiceNoRunningPods(t *testing.T) {
+	tests := []struct {
+		name    string
+		pods    []*corev1.Pod
+		wantLog bool
+	}{
+		{name: "pending", pods: []*corev1.Pod{newPod("web-1", "web", corev1.PodPending)}, wantLog: true},
+		{name: "pending and completed", pods: []*corev1.Pod{newPod("web-1", "web", corev1.PodPending), newPod("web-2", "web", corev1.PodSucceeded)}, wantLog: true},
+		{name: "pending and running", pods: []*corev1.Pod{newPod("web-1", "web", corev1.PodPending), newPod("web-2", "web", corev1.PodRunning)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			clientset := newClientset()
+			for _, pod := range tt.pods {
+				if err := clientset.Tracker().Add(pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sf, err := checkService(context.Background(), newPodCache(clientset, 0), nil, newReplicaSetCache(clientset), enabledChecks(DefaultChecks(), nil), Compliance{}, false, 0,
+				serviceCheck{result: Result{Type: TypeIngress, Name: "web", Namespace: testNamespace, BackendService: "web", ServiceSelectors: map[string]string{"app": "web"}}})
+			if err != nil {
+				t.Fatalf("checkService() error = %v", err)
+			}
+			if sf.noPods || len(sf.findings) == 0 {
+				t.Errorf("checkService() noPods = %t with %d findings, want the pending pods checked", sf.noPods, len(sf.findings))
+			}
+			if got := strings.Contains(logs.String(), "No running pods found"); got != tt.wantLog {
+				t.Errorf("logged no running pods = %t, want %t, logs:\n%s", got, tt.wantLog, logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultWatchDebounce is the default time changes are batched for before the affected namespaces are re-scanned.
+const DefaultWatchDebounce = 10 * time.Second
+
+// WatchOptions controls how Watch re-scans as resources change.
+type WatchOptions struct {
+	// Debounce is how long changes are batched for before the affected namespaces are re-scanned, so a rollout
+	// triggers a single re-scan rather than one per pod. Defaults to DefaultWatchDebounce when less than 1
+	Debounce time.Duration
+
+	ScanTimeout time.Duration // Maximum duration of each scan. 0 for no limit
+
+	// OnNewFailure is called with each failure which was not found by the previous scan of its namespace, starting with
+	// every failure found by the initial scan. Calls are serialised.
+	OnNewFailure func(Finding)
+}
+
+// failureKey identifies a failure independently of the pod it was found on, so a failure is not reported again when
+// its pods are replaced, e.g. by a rollout.
+func failureKey(f Finding) string {
+	return strings.Join([]string{f.Namespace, f.Subject(), f.Ingress, f.OwnerKind, f.Owner, f.Container, f.Check, f.Detail}, "/")
+}
+
+// Watch scans the cluster, then watches the ingresses, services and pods (and workload controllers when
+// opts.AllWorkloads is set) with shared informers, re-scanning the namespaces where they change. Failures which are new
+// since the previous scan of their namespace are passed to watchOpts.OnNewFailure. Errors whilst re-scanning are logged
+// rather than returned, so the watch keeps running. Blocks until ctx is cancelled.
+func Watch(ctx context.Context, clientset kubernetes.Interface, opts Options, watchOpts WatchOptions) error {
+	debounce := watchOpts.Debounce
+	if debounce < 1 {
+		debounce = DefaultWatchDebounce
+	}
+
+	// The failure keys found by the last scan of each namespace
+	previous := make(map[string]map[string]bool)
+	scan := func(namespace string) error {
+		scanCtx := ctx
+		if watchOpts.ScanTimeout > 0 {
+			var cancel context.CancelFunc
+			scanCtx, cancel = context.WithTimeout(ctx, watchOpts.ScanTimeout)
+			defer cancel()
+		}
+		scanOpts := opts
+		if namespace != "" {
+			scanOpts.Namespace, scanOpts.Namespaces = namespace, nil
+		}
+		report, err := Scan(scanCtx, clientset, scanOpts)
+		if err != nil {
+			return err
+		}
+
+		newFailures := 0
+		for _, ns := range report {
+			failures := make(map[string]bool)
+			for _, f := range ns.Findings {
+				if !f.Failed() {
+					continue
+				}
+				key := failureKey(f)
+				if !failures[key] && !previous[ns.Namespace][key] {
+					newFailures++
+					if watchOpts.OnNewFailure != nil {
+						watchOpts.OnNewFailure(f)
+					}
+				}
+				failures[key] = true
+			}
+			previous[ns.Namespace] = failures
+		}
+		slog.Info("Scan complete", "namespace", namespace, "newFailures", newFailures)
+		return nil
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(opts.Namespace))
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+
+	var (
+		mu      sync.Mutex
+		dirty   = make(map[string]bool) // Namespaces with changes since the last scan
+		changed = make(chan struct{}, 1)
+	)
+	markDirty := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			slog.Debug("Ignoring change to unknown object", "err", err)
+			return
+		}
+		namespace, _, _ := cache.SplitMetaNamespaceKey(key)
+		if len(opts.Namespaces) > 0 && !slices.Contains(opts.Namespaces, namespace) {
+			return
+		}
+		mu.Lock()
+		dirty[namespace] = true
+		mu.Unlock()
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if !isInInitialList {
+				markDirty(obj)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) { markDirty(obj) },
+		DeleteFunc: markDirty,
+	}
+
+	watched := []cache.SharedIndexInformer{
+		factory.Networking().V1().Ingresses().Informer(),
+		factory.Core().V1().Services().Informer(),
+		factory.Core().V1().Pods().Informer(),
+	}
+	if opts.AllWorkloads {
+		watched = append(watched,
+			factory.Apps().V1().Deployments().Informer(),
+			factory.Apps().V1().StatefulSets().Informer(),
+			factory.Apps().V1().DaemonSets().Informer(),
+			factory.Batch().V1().CronJobs().Informer(),
+			factory.Batch().V1().Jobs().Informer(),
+		)
+	}
+	for _, informer := range watched {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("error whilst adding watch event handler: %w", err)
+		}
+	}
+
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("error whilst syncing the %v informer", informerType)
+		}
+	}
+	slog.Info("Watching for changes", "debounce", debounce)
+
+	if err := scan(opts.Namespace); err != nil {
+		return err
+	}
+
+	// Changes are batched from the first change after a scan, so constant churn cannot postpone the re-scan forever
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+			if pending == nil {
+				pending = time.After(debounce)
+			}
+		case <-pending:
+			pending = nil
+
+			mu.Lock()
+			namespaces := make([]string, 0, len(dirty))
+			for namespace := range dirty {
+				namespaces = append(namespaces, namespace)
+			}
+			dirty = make(map[string]bool)
+			mu.Unlock()
+			sort.Strings(namespaces)
+
+			for _, namespace := range namespaces {
+				if err := scan(namespace); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					slog.Error("Error whilst re-scanning namespace", "namespace", namespace, "err", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// processWorkloads adds the pod templates of all Deployments, StatefulSets, DaemonSets, CronJobs and Jobs to the
+// results map. Checking the template rather than a running pod catches misconfigurations even when zero replicas are
+// running, such as a CronJob which rarely runs. Jobs created by a CronJob are skipped, as the CronJob's job template
+// is checked instead.
+func processWorkloads(ctx context.Context, clientset kubernetes.Interface, results map[string][]Result, opts Options) error {
+	add := func(kind, workloadNamespace, name string, template corev1.PodTemplateSpec) {
+		results[workloadNamespace] = append(results[workloadNamespace], Result{
+			Type:         TypeWorkload,
+			Name:         name,
+			Namespace:    workloadNamespace,
+			WorkloadKind: kind,
+			Template:     &template,
+		})
+	}
+
+	deployments, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+		list, err := clientset.AppsV1().Deployments(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing deployments: %w", err)
+	}
+	for _, d := range deployments {
+		add("Deployment", d.Namespace, d.Name, d.Spec.Template)
+	}
+
+	statefulSets, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+		list, err := clientset.AppsV1().StatefulSets(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing statefulsets: %w", err)
+	}
+	for _, s := range statefulSets {
+		add("StatefulSet", s.Namespace, s.Name, s.Spec.Template)
+	}
+
+	daemonSets, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+		list, err := clientset.AppsV1().DaemonSets(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing daemonsets: %w", err)
+	}
+	for _, d := range daemonSets {
+		add("DaemonSet", d.Namespace, d.Name, d.Spec.Template)
+	}
+
+	cronJobs, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+		list, err := clientset.BatchV1().CronJobs(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing cronjobs: %w", err)
+	}
+	for _, c := range cronJobs {
+		add("CronJob", c.Namespace, c.Name, c.Spec.JobTemplate.Spec.Template)
+	}
+
+	jobs, err := listAll(opts.PageSize, metav1.ListOptions{}, func(o metav1.ListOptions) ([]batchv1.Job, string, error) {
+		list, err := clientset.BatchV1().Jobs(opts.Namespace).List(ctx, o)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error whilst listing jobs: %w", err)
+	}
+	for _, j := range jobs {
+		if owner := metav1.GetControllerOf(&j); owner != nil && owner.Kind == "CronJob" {
+			continue
+		}
+		add("Job", j.Namespace, j.Name, j.Spec.Template)
+	}
+
+	slog.Info("Found workload controllers", "deployments", len(deployments), "statefulsets", len(statefulSets), "daemonsets", len(daemonSets), "cronjobs", len(cronJobs), "jobs", len(jobs))
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"query-security-contexts/scanner"
+)
+
+// serveShutdownTimeout is how long in-flight requests are given to complete when the server is stopped.
+const serveShutdownTimeout = 10 * time.Second
+
+// findingsServer serves the findings of the latest scan over HTTP.
+// Scans are serialised by mu, so concurrent requests never run overlapping scans against the API server.
+type findingsServer struct {
+	scan     func(ctx context.Context) (structuredReport, error)
+	interval time.Duration // Re-scan in the background on this interval. 0 to scan on each request
+
+	mu      sync.Mutex
+	report  *structuredReport // The latest report when scanning on an interval. Nil until the first scan completes
+	scanErr error             // The error from the latest scan on an interval
+}
+
+// scanOnInterval scans every s.interval until ctx is cancelled, keeping the latest report to be served. The previous
+// report is discarded when a scan fails, so stale findings are not served as current.
+func (s *findingsServer) scanOnInterval(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		report, err := s.scan(ctx)
+		if err != nil {
+			slog.Error("Error whilst scanning", "err", err)
+		}
+
+		s.mu.Lock()
+		s.report, s.scanErr = nil, err
+		if err == nil {
+			s.report = &report
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// latest returns the report to serve: the result of a new scan, or of the latest scan when scanning on an interval.
+func (s *findingsServer) latest(ctx context.Context) (structuredReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.interval == 0 {
+		return s.scan(ctx)
+	}
+	if s.scanErr != nil {
+		return structuredReport{}, s.scanErr
+	}
+	if s.report == nil {
+		return structuredReport{}, errors.New("the first scan has not completed yet")
+	}
+	return *s.report, nil
+}
+
+// handleFindings writes the findings as JSON, in the same format as -output=json.
+func (s *findingsServer) handleFindings(w http.ResponseWriter, r *http.Request) {
+	report, err := s.latest(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error whilst scanning: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, report); err != nil {
+		slog.Error("Error whilst writing findings response", "err", err)
+	}
+}
+
+// handleHealthz reports that the server is running, without scanning.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+// serve runs an HTTP server on addr until interrupted, exposing the findings as JSON at /findings and a health check
+// at /healthz. The cluster (or manifest) is scanned on each request to /findings, or every interval when it is set.
+// The timeout applies to each scan.
+func serve(addr string, interval time.Duration, clientset kubernetes.Interface, opts options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &findingsServer{
+		interval: interval,
+		scan: func(ctx context.Context) (structuredReport, error) {
+			ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+			defer cancel()
+
+			metadata := opts.metadata
+			metadata.Timestamp = time.Now().UTC()
+			report, err := scanReport(ctx, clientset, opts)
+			if err != nil {
+				return structuredReport{}, err
+			}
+			slog.Info("Scan complete", "failingFindings", scanner.Failures(report))
+			return structuredReport{Metadata: metadata, Namespaces: report}, nil
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/findings", s.handleFindings)
+	mux.HandleFunc("/healthz", handleHealthz)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	if interval > 0 {
+		go s.scanOnInterval(ctx)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Serving findings", "addr", addr, "interval", interval)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("error whilst serving findings: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error whilst shutting down the server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"query-security-contexts/scanner"
+)
+
+// slackTopNamespaces is the number of namespaces with the most failures listed in the Slack message.
+const slackTopNamespaces = 5
+
+// slackMessage returns a summary of the failing checks for posting to Slack: the number of failures by severity and
+// the namespaces with the most failures. The second return value is the total number of failures.
+func slackMessage(report []scanner.NamespaceFindings) (string, int) {
+	bySeverity := make(map[string]int)
+	byNamespace := make(map[string]int)
+	total := 0
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if !f.Failed() {
+				continue
+			}
+			bySeverity[f.Severity]++
+			byNamespace[clusterNamespace(ns)]++
+			total++
+		}
+	}
+
+	var b strings.Builder
+	if total == 0 {
+		fmt.Fprintf(&b, ":white_check_mark: No failing security context checks found across %d namespaces", len(report))
+		return b.String(), total
+	}
+
+	fmt.Fprintf(&b, ":rotating_light: *%d failing security context checks found*\n", total)
+	for _, severity := range severityOrder {
+		if bySeverity[severity] > 0 {
+			fmt.Fprintf(&b, "• %s: %d\n", severity, bySeverity[severity])
+		}
+	}
+
+	namespaces := sortedKeys(byNamespace)
+	sort.SliceStable(namespaces, func(a, c int) bool { return byNamespace[namespaces[a]] > byNamespace[namespaces[c]] })
+	if len(namespaces) > slackTopNamespaces {
+		namespaces = namespaces[:slackTopNamespaces]
+	}
+	b.WriteString("*Top namespaces*\n")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(&b, "• %s: %d\n", namespace, byNamespace[namespace])
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), total
+}
+
+// notifySlack posts a summary of the failing checks to the Slack Incoming Webhook at url. Nothing is posted when
+// there are no failures, unless always is set.
+func notifySlack(ctx context.Context, url string, always bool, report []scanner.NamespaceFindings) error {
+	text, failures := slackMessage(report)
+	if failures == 0 && !always {
+		return nil
+	}
+	return postSlack(ctx, http.DefaultClient, url, text)
+}
+
+// postSlack posts the text as a message to the Slack Incoming Webhook at url.
+func postSlack(ctx context.Context, client *http.Client, url, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("error whilst encoding Slack message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error whilst creating Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error whilst posting to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("error whilst posting to Slack: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"query-security-contexts/scanner"
+)
+
+// slackServer returns a test server which records the text of each message posted to it, responding with status.
+func slackServer(t *testing.T, status int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("error whilst decoding the request body: %v", err)
+		}
+		posted = append(posted, body["text"])
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("invalid_payload\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &posted
+}
+
+func TestPostSlack(t *testing.T) {
+	server, posted := slackServer(t, http.StatusOK)
+
+	if err := postSlack(context.Background(), server.Client(), server.URL, "3 failing checks"); err != nil {
+		t.Fatalf("postSlack() error = %v", err)
+	}
+	if len(*posted) != 1 || (*posted)[0] != "3 failing checks" {
+		t.Errorf("posted = %q, want [3 failing checks]", *posted)
+	}
+}
+
+func TestPostSlackError(t *testing.T) {
+	server, _ := slackServer(t, http.StatusBadRequest)
+
+	err := postSlack(context.Background(), server.Client(), server.URL, "3 failing checks")
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: invalid_payload") {
+		t.Errorf("postSlack() error = %v, want the status and response body", err)
+	}
+}
+
+func TestNotifySlack(t *testing.T) {
+	passing := []scanner.NamespaceFindings{{Namespace: "payments", Findings: []scanner.Finding{
+		{Namespace: "payments", Check: scanner.CheckPrivileged, Severity: scanner.SeverityCritical, Passed: true},
+	}}}
+	failing := []scanner.NamespaceFindings{{Namespace: "payments", Cluster: "prod", Findings: []scanner.Finding{
+		{Namespace: "payments", Check: scanner.CheckPrivileged, Severity: scanner.SeverityCritical},
+	}}}
+
+	tests := []struct {
+		name   string
+		always bool
+		report []scanner.NamespaceFindings
+		want   string // The text which is posted, empty when nothing should be
+	}{
+		{name: "no failures", report: passing},
+		{name: "no failures with always", always: true, report: passing, want: "No failing security context checks found across 1 namespaces"},
+		{name: "failures", report: failing, want: "• prod/payments: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, posted := slackServer(t, http.StatusOK)
+
+			if err := notifySlack(context.Background(), server.URL, tt.always, tt.report); err != nil {
+				t.Fatalf("notifySlack() error = %v", err)
+			}
+			if tt.want == "" {
+				if len(*posted) != 0 {
+					t.Errorf("posted = %q, want nothing", *posted)
+				}
+				return
+			}
+			if len(*posted) != 1 || !strings.Contains((*posted)[0], tt.want) {
+				t.Errorf("posted = %q, want a message containing %q", *posted, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+
+	"query-security-contexts/scanner"
+)
+
+// outputExtensions is the file extension for each output format, used when writing a report file per namespace.
+var outputExtensions = map[string]string{
+	outputText:   ".txt",
+	outputTable:  ".txt",
+	outputJSON:   ".json",
+	outputNDJSON: ".ndjson",
+	outputYAML:   ".yaml",
+	outputCSV:    ".csv",
+	outputSARIF:  ".sarif",
+	outputJUnit:  ".xml",
+}
+
+// writeNDJSON writes each finding in the report to w as a single line of JSON, for when the findings were not streamed.
+func writeNDJSON(w io.Writer, report []scanner.NamespaceFindings) error {
+	write, writeErr := streamNDJSON(w)
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			write(f)
+		}
+	}
+	return writeErr()
+}
+
+// writeSplitReport writes a report file for each namespace to dir in the given output format, named after the
+// namespace, e.g. payments.json, so each can be routed to the team which owns it. Namespaces without any findings are
+// skipped unless includeEmpty is set. Existing files are truncated. showPassed is passed through to writeReport.
+func writeSplitReport(dir, output string, showPassed bool, metadata scanMetadata, report []scanner.NamespaceFindings, includeEmpty bool) error {
+	written := 0
+	for _, ns := range report {
+		if len(ns.Findings) == 0 && !includeEmpty {
+			continue
+		}
+
+		path := filepath.Join(dir, ns.Namespace+outputExtensions[output])
+		file, err := createOutputFile(path)
+		if err != nil {
+			return err
+		}
+		nsReport := []scanner.NamespaceFindings{ns}
+		if output == outputNDJSON {
+			err = writeNDJSON(file, nsReport)
+		} else {
+			err = writeReport(file, output, false, showPassed, metadata, nsReport)
+		}
+		if closeErr := file.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error whilst closing output file %s: %w", path, closeErr))
+		}
+		if err != nil {
+			return err
+		}
+		written++
+	}
+	slog.Info("Wrote a report per namespace", "dir", dir, "files", written)
+	return nil
+}
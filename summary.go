@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"query-security-contexts/scanner"
+)
+
+// clusterNamespace returns the namespace's name, prefixed with its cluster when scanning several, e.g. prod/payments,
+// so namespaces of the same name in different clusters are counted separately.
+func clusterNamespace(ns scanner.NamespaceFindings) string {
+	if ns.Cluster == "" {
+		return ns.Namespace
+	}
+	return ns.Cluster + "/" + ns.Namespace
+}
+
+// writeSummary writes tables of the number of failing checks per check type and per namespace, in place of the
+// individual findings. Namespaces without failures are still listed so the scan coverage is visible.
+func writeSummary(w io.Writer, report []scanner.NamespaceFindings) error {
+	byCheck := make(map[string]int)
+	severities := make(map[string]string) // Taken from the findings, so custom policy rules show their own severity
+	byNamespace := make(map[string]int, len(report))
+	total := 0
+	for _, ns := range report {
+		namespace := clusterNamespace(ns)
+		byNamespace[namespace] += 0
+		for _, f := range ns.Findings {
+			if !f.Failed() {
+				continue
+			}
+			byCheck[f.Check]++
+			severities[f.Check] = f.Severity
+			byNamespace[namespace]++
+			total++
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSEVERITY\tFAILURES")
+	for _, check := range sortedKeys(byCheck) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", check, severities[check], byCheck[check])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "NAMESPACE\tFAILURES")
+	for _, namespace := range sortedKeys(byNamespace) {
+		fmt.Fprintf(tw, "%s\t%d\n", namespace, byNamespace[namespace])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "TOTAL\t%d\n", total)
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("error whilst writing summary: %w", err)
+	}
+	return nil
+}
+
+// writeSummaryLine writes a single line of stable key=value pairs, e.g.
+// SCAN_RESULT findings=12 critical=2 high=5 medium=4 low=1 namespaces=34 duration=3.2s, so scripts can grep the result
+// of the scan without parsing the output. The counts are of the failing findings, and the duration is in seconds.
+func writeSummaryLine(w io.Writer, report []scanner.NamespaceFindings, duration time.Duration) error {
+	bySeverity := make(map[string]int)
+	for _, ns := range report {
+		for _, f := range ns.Findings {
+			if f.Failed() {
+				bySeverity[f.Severity]++
+			}
+		}
+	}
+
+	line := fmt.Sprintf("SCAN_RESULT findings=%d", scanner.Failures(report))
+	for _, severity := range severityOrder {
+		line += fmt.Sprintf(" %s=%d", severity, bySeverity[severity])
+	}
+	line += fmt.Sprintf(" namespaces=%d duration=%.1fs", len(report), duration.Seconds())
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return fmt.Errorf("error whilst writing summary line: %w", err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"query-security-contexts/scanner"
+)
+
+// templateData is the context the -output-template is executed against.
+type templateData struct {
+	Metadata   scanMetadata
+	Namespaces []scanner.NamespaceFindings
+	Findings   []scanner.Finding // Every finding across the namespaces, for ranging over directly
+}
+
+// templateFuncs are the functions available to output templates, in addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseOutputTemplate parses the Go text/template for the -output-template flag. The value is read as a file when it
+// is the path of one, otherwise it is the template itself.
+func parseOutputTemplate(value string) (*template.Template, error) {
+	text := value
+	if info, err := os.Stat(value); err == nil && info.Mode().IsRegular() {
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("error whilst reading output template: %w", err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error whilst parsing output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeTemplate executes the output template against the scan metadata and findings, writing the result to w.
+func writeTemplate(w io.Writer, tmpl *template.Template, metadata scanMetadata, report []scanner.NamespaceFindings) error {
+	data := templateData{Metadata: metadata, Namespaces: report}
+	for _, ns := range report {
+		data.Findings = append(data.Findings, ns.Findings...)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return fmt.Errorf("error whilst executing output template: %w", err)
+	}
+	return nil
+}